@@ -3,10 +3,12 @@ module github.com/tabilet/nscheck
 go 1.24.5
 
 require (
+	github.com/hashicorp/hcl v1.0.1-vault-5
 	github.com/jackc/pgx/v5 v5.7.5
 	github.com/openbao/openbao/api/auth/approle/v2 v2.3.1
 	github.com/openbao/openbao/api/v2 v2.3.1
 	github.com/taosdata/driver-go/v3 v3.7.4
+	golang.org/x/crypto v0.39.0
 )
 
 require (
@@ -22,7 +24,6 @@ require (
 	github.com/hashicorp/go-secure-stdlib/parseutil v0.2.0 // indirect
 	github.com/hashicorp/go-secure-stdlib/strutil v0.1.2 // indirect
 	github.com/hashicorp/go-sockaddr v1.0.7 // indirect
-	github.com/hashicorp/hcl v1.0.1-vault-5 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
@@ -31,9 +32,9 @@ require (
 	github.com/modern-go/concurrent v0.0.0-20180228061459-e0a39a4cb421 // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/ryanuber/go-glob v1.0.0 // indirect
-	golang.org/x/crypto v0.39.0 // indirect
 	golang.org/x/net v0.41.0 // indirect
 	golang.org/x/sync v0.15.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
 	golang.org/x/text v0.26.0 // indirect
 	golang.org/x/time v0.12.0 // indirect
 )
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/openbao/openbao/api/v2"
@@ -13,6 +14,8 @@ import (
 func CheckACLRoot(client *api.Client) error {
 	ctx := context.Background()
 
+	canReadNotWrite, canReadAndWrite := getACLAssertions(client.Token())
+
 	for _, f := range []func(context.Context, *api.Client, string, string, string, string, string, string) (string, string, error){
 		getTokensUserpass,
 		getTokensClient,
@@ -35,14 +38,14 @@ func CheckACLRoot(client *api.Client) error {
 
 		// userToken1 can read "mysecret"
 		client.SetToken(userToken1)
-		err = canReadNotWriteTitle(ctx, client, path, title)
+		err = canReadNotWrite(ctx, client, path, title)
 		if err != nil {
 			return err
 		}
 
 		// userToken2 can read "mysecret"
 		client.SetToken(userToken2)
-		err = canReadAndWriteTitle(ctx, client, path, title)
+		err = canReadAndWrite(ctx, client, path, title)
 		if err != nil {
 			return err
 		}
@@ -65,6 +68,8 @@ func CheckACLRoot(client *api.Client) error {
 func CheckACLNamespace(client *api.Client) error {
 	ctx := context.Background()
 
+	canReadNotWrite, canReadAndWrite := getACLAssertions(client.Token())
+
 	for _, f := range []func(context.Context, *api.Client, string, string, string, string, string, string) (string, string, error){
 		getTokensUserpass,
 		getTokensClient,
@@ -93,14 +98,14 @@ func CheckACLNamespace(client *api.Client) error {
 
 		// userToken1 can read "mysecret"
 		clone.SetToken(userToken1)
-		err = canReadNotWriteTitle(ctx, clone, path, title)
+		err = canReadNotWrite(ctx, clone, path, title)
 		if err != nil {
 			return err
 		}
 
 		// userToken2 can read "mysecret"
 		clone.SetToken(userToken2)
-		err = canReadAndWriteTitle(ctx, clone, path, title)
+		err = canReadAndWrite(ctx, clone, path, title)
 		if err != nil {
 			return err
 		}
@@ -128,6 +133,9 @@ func CheckACLNamespace(client *api.Client) error {
 // CheckACLMixNormal checks if the ACL auth is mounted and can be deleted in the root and namespace.
 func CheckACLMixNormal(client *api.Client) error {
 	ctx := context.Background()
+
+	canReadNotWrite, canReadAndWrite := getACLAssertions(client.Token())
+
 	for _, f := range []func(context.Context, *api.Client, string, string, string, string, string, string) (string, string, error){
 		getTokensUserpass,
 		getTokensClient,
@@ -177,39 +185,39 @@ func CheckACLMixNormal(client *api.Client) error {
 
 		// userToken1 can read the default namespace
 		client.SetToken(userToken1)
-		err = canReadNotWriteTitle(ctx, client, path, title)
+		err = canReadNotWrite(ctx, client, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken3 can not read the default namespace
 		client.SetToken(userToken3)
-		err = canReadNotWriteTitle(ctx, client, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, client, path, title)
+		if !isDenied(err) {
 			return err
 		}
 		// userToken5 can not read the default namespace
 		client.SetToken(userToken5)
-		err = canReadNotWriteTitle(ctx, client, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, client, path, title)
+		if !isDenied(err) {
 			return err
 		}
 
 		// userToken2 can write the default namespace
 		client.SetToken(userToken2)
-		err = canReadAndWriteTitle(ctx, client, path, title)
+		err = canReadAndWrite(ctx, client, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken4 can not write the default namespace
 		client.SetToken(userToken4)
-		err = canReadNotWriteTitle(ctx, client, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, client, path, title)
+		if !isDenied(err) {
 			return err
 		}
 		// userToken6 can not write the default namespace
 		client.SetToken(userToken6)
-		err = canReadNotWriteTitle(ctx, client, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, client, path, title)
+		if !isDenied(err) {
 			return err
 		}
 
@@ -217,39 +225,39 @@ func CheckACLMixNormal(client *api.Client) error {
 
 		// userToken1 can not read the ns1 namespace
 		clone.SetToken(userToken1)
-		err = canReadNotWriteTitle(ctx, clone, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, clone, path, title)
+		if !isDenied(err) {
 			return err
 		}
 		// userToken3 can read the ns1 namespace
 		clone.SetToken(userToken3)
-		err = canReadNotWriteTitle(ctx, clone, path, title)
+		err = canReadNotWrite(ctx, clone, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken5 can not read the ns1 namespace
 		clone.SetToken(userToken5)
-		err = canReadNotWriteTitle(ctx, clone, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, clone, path, title)
+		if !isDenied(err) {
 			return err
 		}
 
 		// userToken2 can not write the ns1 namespace
 		clone.SetToken(userToken2)
-		err = canReadNotWriteTitle(ctx, clone, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, clone, path, title)
+		if !isDenied(err) {
 			return err
 		}
 		// userToken4 can write the ns1 namespace
 		clone.SetToken(userToken4)
-		err = canReadAndWriteTitle(ctx, clone, path, title)
+		err = canReadAndWrite(ctx, clone, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken6 can not write the ns1 namespace
 		clone.SetToken(userToken6)
-		err = canReadNotWriteTitle(ctx, clone, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, clone, path, title)
+		if !isDenied(err) {
 			return err
 		}
 
@@ -257,37 +265,37 @@ func CheckACLMixNormal(client *api.Client) error {
 
 		// userToken1 can not read the ns1/ns2 namespace
 		clone2.SetToken(userToken1)
-		err = canReadNotWriteTitle(ctx, clone2, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, clone2, path, title)
+		if !isDenied(err) {
 			return err
 		}
 		// userToken3 can not read the ns1/ns2 namespace
 		clone2.SetToken(userToken3)
-		err = canReadNotWriteTitle(ctx, clone2, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, clone2, path, title)
+		if !isDenied(err) {
 			return err
 		}
 		// userToken5 can read the ns1/ns2 namespace
 		clone2.SetToken(userToken5)
-		err = canReadNotWriteTitle(ctx, clone2, path, title)
+		err = canReadNotWrite(ctx, clone2, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken2 can not write the ns1/ns2 namespace
 		clone2.SetToken(userToken2)
-		err = canReadNotWriteTitle(ctx, clone2, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, clone2, path, title)
+		if !isDenied(err) {
 			return err
 		}
 		// userToken4 can not write the ns1/ns2 namespace
 		clone2.SetToken(userToken4)
-		err = canReadNotWriteTitle(ctx, clone2, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, clone2, path, title)
+		if !isDenied(err) {
 			return err
 		}
 		// userToken6 can write the ns1/ns2 namespace
 		clone2.SetToken(userToken6)
-		err = canReadAndWriteTitle(ctx, clone2, path, title)
+		err = canReadAndWrite(ctx, clone2, path, title)
 		if err != nil {
 			return err
 		}
@@ -339,6 +347,8 @@ func CheckACLMixNormal(client *api.Client) error {
 func CheckACLMixPower(client *api.Client) error {
 	ctx := context.Background()
 
+	canReadNotWrite, canReadAndWrite := getACLAssertions(client.Token())
+
 	for _, f := range []func(context.Context, *api.Client, string, string, string, string, string, string) (string, string, error){
 		getTokensUserpass,
 		getTokensClient,
@@ -387,39 +397,39 @@ func CheckACLMixPower(client *api.Client) error {
 
 		// userToken1 can read the default namespace
 		client.SetToken(userToken1)
-		err = canReadNotWriteTitle(ctx, client, path, title)
+		err = canReadNotWrite(ctx, client, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken3 can not read the default namespace
 		client.SetToken(userToken3)
-		err = canReadNotWriteTitle(ctx, client, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, client, path, title)
+		if !isDenied(err) {
 			return err
 		}
 		// userToken5 can not read the default namespace
 		client.SetToken(userToken5)
-		err = canReadNotWriteTitle(ctx, client, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, client, path, title)
+		if !isDenied(err) {
 			return err
 		}
 
 		// userToken2 can write the default namespace
 		client.SetToken(userToken2)
-		err = canReadAndWriteTitle(ctx, client, path, title)
+		err = canReadAndWrite(ctx, client, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken4 can not write the default namespace
 		client.SetToken(userToken4)
-		err = canReadNotWriteTitle(ctx, client, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, client, path, title)
+		if !isDenied(err) {
 			return err
 		}
 		// userToken6 can not write the default namespace
 		client.SetToken(userToken6)
-		err = canReadNotWriteTitle(ctx, client, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, client, path, title)
+		if !isDenied(err) {
 			return err
 		}
 
@@ -427,39 +437,39 @@ func CheckACLMixPower(client *api.Client) error {
 
 		// userToken1 can read the ns1 namespace
 		clone.SetToken(userToken1)
-		err = canReadNotWriteTitle(ctx, clone, path, title)
+		err = canReadNotWrite(ctx, clone, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken3 can read the ns1 namespace
 		clone.SetToken(userToken3)
-		err = canReadNotWriteTitle(ctx, clone, path, title)
+		err = canReadNotWrite(ctx, clone, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken5 can not read the ns1 namespace
 		clone.SetToken(userToken5)
-		err = canReadNotWriteTitle(ctx, clone, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, clone, path, title)
+		if !isDenied(err) {
 			return err
 		}
 
 		// userToken2 can write the ns1 namespace
 		clone.SetToken(userToken2)
-		err = canReadNotWriteTitle(ctx, clone, path, title)
+		err = canReadAndWrite(ctx, clone, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken4 can write the ns1 namespace
 		clone.SetToken(userToken4)
-		err = canReadAndWriteTitle(ctx, clone, path, title)
+		err = canReadAndWrite(ctx, clone, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken6 can not write the ns1 namespace
 		clone.SetToken(userToken6)
-		err = canReadNotWriteTitle(ctx, clone, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, clone, path, title)
+		if !isDenied(err) {
 			return err
 		}
 
@@ -467,37 +477,37 @@ func CheckACLMixPower(client *api.Client) error {
 
 		// userToken1 can not read the ns1/ns2 namespace
 		clone2.SetToken(userToken1)
-		err = canReadNotWriteTitle(ctx, clone2, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, clone2, path, title)
+		if !isDenied(err) {
 			return err
 		}
 		// userToken3 can read the ns1/ns2 namespace
 		clone2.SetToken(userToken3)
-		err = canReadNotWriteTitle(ctx, clone2, path, title)
+		err = canReadNotWrite(ctx, clone2, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken5 can read the ns1/ns2 namespace
 		clone2.SetToken(userToken5)
-		err = canReadNotWriteTitle(ctx, clone2, path, title)
+		err = canReadNotWrite(ctx, clone2, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken2 can not write the ns1/ns2 namespace
 		clone2.SetToken(userToken2)
-		err = canReadNotWriteTitle(ctx, clone2, path, title)
-		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		err = canReadNotWrite(ctx, clone2, path, title)
+		if !isDenied(err) {
 			return err
 		}
 		// userToken4 can write the ns1/ns2 namespace
 		clone2.SetToken(userToken4)
-		err = canReadNotWriteTitle(ctx, clone2, path, title)
+		err = canReadAndWrite(ctx, clone2, path, title)
 		if err != nil {
 			return err
 		}
 		// userToken6 can write the ns1/ns2 namespace
 		clone2.SetToken(userToken6)
-		err = canReadAndWriteTitle(ctx, clone2, path, title)
+		err = canReadAndWrite(ctx, clone2, path, title)
 		if err != nil {
 			return err
 		}
@@ -545,6 +555,189 @@ func CheckACLMixPower(client *api.Client) error {
 	return nil
 }
 
+// CheckACLMatrix checks the glob "*" and segment wildcard "+" semantics of policy paths. Each policy path
+// is granted to a token in the root namespace and to a token in ns1, and each token reads a KV1 secret
+// in every namespace of the tree ns1/ns2/ns3 plus the sibling nsx. The outcome is compared to the
+// one expected from the path semantics, and all discrepancies are reported as a table.
+func CheckACLMatrix(client *api.Client) error {
+	ctx := context.Background()
+
+	rootToken := client.Token()
+
+	// namespaces relative to the root namespace, parents first
+	namespaces := []string{"", "ns1", "ns1/ns2", "ns1/ns2/ns3", "nsx"}
+	clients := map[string]*api.Client{"": client}
+	for _, ns := range namespaces[1:] {
+		parent, name := splitNamespace(ns)
+		clone, err := cloneClient(ctx, clients[parent], name)
+		if err != nil {
+			return err
+		}
+		clients[ns] = clone
+	}
+
+	path := "glob"
+	secrets := []string{path + "/a", path + "/a/b"}
+	for _, ns := range namespaces {
+		c := clients[ns]
+		err := c.Sys().MountWithContext(ctx, path, &api.MountInput{
+			Type: "kv",
+		})
+		if err != nil {
+			return err
+		}
+		time.Sleep(sleeping)
+		for _, secret := range secrets {
+			_, err = c.Logical().WriteWithContext(ctx, secret, map[string]any{
+				"username": "myadmin",
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	policyPaths := []string{
+		path + "/*",
+		path + "/a",
+		path + "/+/b",
+		"+/" + path + "/*",
+		"+/+/" + path + "/*",
+		"+/+/+/" + path + "/a",
+		"ns1/" + path + "/*",
+		"ns1/+/" + path + "/*",
+		"ns1/*",
+		"ns2/" + path + "/*",
+		"+/ns2/" + path + "/a",
+	}
+
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOKEN NS\tPOLICY PATH\tREQUEST NS\tREQUEST PATH\tEXPECTED\tGOT")
+	discrepancies := 0
+	for _, tokenNS := range []string{"", "ns1"} {
+		c := clients[tokenNS]
+		for i, policyPath := range policyPaths {
+			name := fmt.Sprintf("glob%d", i)
+			err := c.Sys().PutPolicyWithContext(ctx, name, `
+	path "`+policyPath+`" {
+		capabilities = ["read"]
+	}
+	`)
+			if err != nil {
+				return err
+			}
+			_, secret, err := getTokenAuthSecret(ctx, c, rootToken, name)
+			if err != nil {
+				return err
+			}
+			token := secret.Auth.ClientToken
+
+			for _, requestNS := range namespaces {
+				tokenClient, err := newTokenClient(clients[requestNS], token)
+				if err != nil {
+					return err
+				}
+				for _, secretPath := range secrets {
+					expected := false
+					if relative, ok := relativeNamespace(tokenNS, requestNS); ok {
+						expected = matchPolicyPath(policyPath, relative+secretPath)
+					}
+					_, err = tokenClient.Logical().ReadWithContext(ctx, secretPath)
+					if err != nil && !strings.Contains(err.Error(), "permission denied") {
+						return err
+					}
+					if got := err == nil; got != expected {
+						discrepancies++
+						fmt.Fprintf(w, "%q\t%s\t%q\t%s\t%t\t%t\n", tokenNS, policyPath, requestNS, secretPath, expected, got)
+					}
+				}
+			}
+		}
+	}
+	w.Flush()
+
+	// clean up
+	for i := len(namespaces) - 1; i >= 0; i-- {
+		ns := namespaces[i]
+		c := clients[ns]
+		c.SetToken(rootToken)
+		err := c.Sys().UnmountWithContext(ctx, path)
+		if err != nil {
+			return err
+		}
+		if ns == "" {
+			for i := range policyPaths {
+				err = c.Sys().DeletePolicyWithContext(ctx, fmt.Sprintf("glob%d", i))
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		parent, name := splitNamespace(ns)
+		_, err = clients[parent].Logical().DeleteWithContext(ctx, "sys/namespaces/"+name)
+		if err != nil {
+			return err
+		}
+		time.Sleep(sleeping)
+	}
+
+	if discrepancies > 0 {
+		return fmt.Errorf("%d discrepancies in the policy matrix:\n%s", discrepancies, table.String())
+	}
+	return nil
+}
+
+// splitNamespace splits the namespace path into its parent and its last name.
+func splitNamespace(ns string) (string, string) {
+	if i := strings.LastIndex(ns, "/"); i >= 0 {
+		return ns[:i], ns[i+1:]
+	}
+	return "", ns
+}
+
+// relativeNamespace returns the path prefix of requestNS relative to tokenNS,
+// and false if requestNS is not tokenNS or one of its descendants.
+func relativeNamespace(tokenNS, requestNS string) (string, bool) {
+	if tokenNS == requestNS {
+		return "", true
+	}
+	if tokenNS == "" {
+		return requestNS + "/", true
+	}
+	if strings.HasPrefix(requestNS, tokenNS+"/") {
+		return strings.TrimPrefix(requestNS, tokenNS+"/") + "/", true
+	}
+	return "", false
+}
+
+// matchPolicyPath reports whether the policy path matches the request path. A trailing "*" matches
+// any suffix, and a "+" matches exactly one path segment.
+func matchPolicyPath(policyPath, requestPath string) bool {
+	glob := strings.HasSuffix(policyPath, "*")
+	policySegments := strings.Split(strings.TrimSuffix(policyPath, "*"), "/")
+	requestSegments := strings.Split(requestPath, "/")
+	if len(requestSegments) < len(policySegments) || (!glob && len(requestSegments) != len(policySegments)) {
+		return false
+	}
+	for i, segment := range policySegments {
+		switch {
+		case segment == "+":
+			if requestSegments[i] == "" {
+				return false
+			}
+		case glob && i == len(policySegments)-1:
+			if !strings.HasPrefix(requestSegments[i], segment) {
+				return false
+			}
+		case segment != requestSegments[i]:
+			return false
+		}
+	}
+	return true
+}
+
 // getKV2Read returns the ACL policy for reading KV2 secrets.
 func getKV2Read(path string) string {
 	return `
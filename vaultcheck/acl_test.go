@@ -55,3 +55,16 @@ func TestACLMixPower(t *testing.T) {
 		t.Fatalf("ACLMixPower failed: %v", err)
 	}
 }
+
+// TestACLMatrix is a test function that checks the glob and segment wildcard semantics of policy paths across a namespace tree.
+func TestACLMatrix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckACLMatrix(client)
+	if err != nil {
+		t.Fatalf("ACLMatrix failed: %v", err)
+	}
+}
@@ -2,8 +2,11 @@ package vaultcheck
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"regexp"
 	"slices"
 	"time"
 
@@ -164,8 +167,8 @@ func CheckApproleMix(client *api.Client) error {
 		return err
 	}
 	secret, err = auth.Login(ctx, clone)
-	if err == nil {
-		return fmt.Errorf("error should exist, but we got nil. secret id: %#v", secret)
+	if !isApproleRejection(err) {
+		return fmt.Errorf("login with the root role in the namespace: %#v, %v", secret, err)
 	}
 
 	authNS, err := approle.NewAppRoleAuth(roleNS, &approle.SecretID{FromString: secretNS})
@@ -173,8 +176,8 @@ func CheckApproleMix(client *api.Client) error {
 		return err
 	}
 	secret, err = authNS.Login(ctx, client)
-	if err == nil {
-		return fmt.Errorf("error should exist, but we got nil. secret id: %#v", secret)
+	if !isApproleRejection(err) {
+		return fmt.Errorf("login with the namespace role in the root namespace: %#v, %v", secret, err)
 	}
 
 	err = dropApprole(clone, ctx, secretNS, path, "yourrole")
@@ -195,6 +198,757 @@ func CheckApproleMix(client *api.Client) error {
 	return nil
 }
 
+// CheckApproleConstraintsRoot checks the secret-id and token constraints of AppRole roles in the root namespace.
+func CheckApproleConstraintsRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	return checkApproleConstraints(ctx, client, "approle")
+}
+
+// CheckApproleConstraintsNamespace checks the secret-id and token constraints of AppRole roles in the namespace.
+func CheckApproleConstraintsNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	err = checkApproleConstraints(ctx, clone, "approle")
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckApproleConstraintsMix checks that the settings of a role in the root namespace
+// do not influence an identically named role in the namespace, and vice versa.
+func CheckApproleConstraintsMix(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	path := "approle"
+	for _, c := range []*api.Client{client, clone} {
+		err = c.Sys().EnableAuthWithOptionsWithContext(ctx, path, &api.EnableAuthOptions{
+			Type: "approle",
+		})
+		if err != nil {
+			return err
+		}
+	}
+	time.Sleep(sleeping)
+
+	// the same role name, limited to 1 use in the root namespace and unlimited in the namespace
+	roleID, secretID, err := putApproleRole(ctx, client, path, "myrole", map[string]any{
+		"secret_id_num_uses": 1,
+		"token_num_uses":     1,
+	})
+	if err != nil {
+		return err
+	}
+	roleNS, secretNS, err := putApproleRole(ctx, clone, path, "myrole", nil)
+	if err != nil {
+		return err
+	}
+	if roleID == roleNS {
+		return fmt.Errorf("same role id %s in both namespaces", roleID)
+	}
+
+	secret, err := clone.Logical().ReadWithContext(ctx, "auth/"+path+"/role/myrole")
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Data == nil {
+		return fmt.Errorf("no secret")
+	}
+	if fmt.Sprint(secret.Data["secret_id_num_uses"]) != "0" || fmt.Sprint(secret.Data["token_num_uses"]) != "0" {
+		return fmt.Errorf("%#v", secret.Data)
+	}
+
+	token, err := loginApprole(ctx, client, path, roleID, secretID)
+	if err != nil {
+		return err
+	}
+	_, err = loginApprole(ctx, client, path, roleID, secretID)
+	if !isApproleRejection(err) {
+		return fmt.Errorf("secret id used twice in the root namespace: %v", err)
+	}
+	err = checkTokenUses(ctx, client, token, 1)
+	if err != nil {
+		return err
+	}
+
+	// neither the secret id nor the token is limited in the namespace
+	for range 3 {
+		token, err = loginApprole(ctx, clone, path, roleNS, secretNS)
+		if err != nil {
+			return err
+		}
+	}
+	tokenClient, err := newTokenClient(clone, token)
+	if err != nil {
+		return err
+	}
+	for range 3 {
+		ok, err := isTokenValid(ctx, tokenClient)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("token of unlimited uses denied in namespace %s", clone.Namespace())
+		}
+	}
+
+	// clean up
+	err = clone.Sys().DisableAuthWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	err = client.Sys().DisableAuthWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	client.SetNamespace(os.Getenv("VAULT_NAMESPACE"))
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckApproleWrapped checks that a response-wrapped secret id, generated in the namespace pname/cname,
+// can be unwrapped exactly once and before its TTL, from the same and the parent namespace only.
+func CheckApproleWrapped(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+	subNS := "cname"
+	clone2, err := cloneClient(ctx, clone, subNS)
+	if err != nil {
+		return err
+	}
+	siblingNS := "dname"
+	sibling, err := cloneClient(ctx, clone, siblingNS)
+	if err != nil {
+		return err
+	}
+
+	path := "approle"
+	err = clone2.Sys().EnableAuthWithOptionsWithContext(ctx, path, &api.EnableAuthOptions{
+		Type: "approle",
+	})
+	if err != nil {
+		return err
+	}
+	time.Sleep(sleeping)
+	roleID, _, err := putApproleRole(ctx, clone2, path, "myrole", nil)
+	if err != nil {
+		return err
+	}
+
+	// the wrapping token tells where it was created
+	wrappingToken, err := wrapSecretID(ctx, clone2, path, "myrole", "60s")
+	if err != nil {
+		return err
+	}
+	secret, err := clone2.Logical().WriteWithContext(ctx, "sys/wrapping/lookup", map[string]any{
+		"token": wrappingToken,
+	})
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["creation_path"] != "auth/"+path+"/role/myrole/secret-id" {
+		return fmt.Errorf("wrapping lookup: %+v", secret)
+	}
+
+	// unwrap in the same namespace, and in the parent namespace
+	for _, c := range []*api.Client{clone2, clone} {
+		wrappingToken, err = wrapSecretID(ctx, clone2, path, "myrole", "60s")
+		if err != nil {
+			return err
+		}
+		secret, err = c.Logical().UnwrapWithContext(ctx, wrappingToken)
+		if err != nil {
+			return fmt.Errorf("unwrap in %s: %w", c.Namespace(), err)
+		}
+		if secret == nil || secret.Data == nil || secret.Data["secret_id"] == nil {
+			return fmt.Errorf("unwrap in %s: %+v", c.Namespace(), secret)
+		}
+		_, err = loginApprole(ctx, clone2, path, roleID, secret.Data["secret_id"].(string))
+		if err != nil {
+			return err
+		}
+		// single use
+		_, err = c.Logical().UnwrapWithContext(ctx, wrappingToken)
+		if !isUnwrapRejection(err) {
+			return fmt.Errorf("wrapping token unwrapped twice in %s: %v", c.Namespace(), err)
+		}
+	}
+
+	// unwrap in the sibling namespace
+	wrappingToken, err = wrapSecretID(ctx, clone2, path, "myrole", "60s")
+	if err != nil {
+		return err
+	}
+	secret, err = sibling.Logical().UnwrapWithContext(ctx, wrappingToken)
+	if !isUnwrapRejection(err) {
+		return fmt.Errorf("wrapping token unwrapped in sibling %s: %+v, %v", sibling.Namespace(), secret, err)
+	}
+
+	// log in with the wrapping token, which is consumed by the login
+	wrappingToken, err = wrapSecretID(ctx, clone2, path, "myrole", "60s")
+	if err != nil {
+		return err
+	}
+	auth, err := approle.NewAppRoleAuth(roleID, &approle.SecretID{FromString: wrappingToken}, approle.WithWrappingToken(), approle.WithMountPath(path))
+	if err != nil {
+		return err
+	}
+	secret, err = auth.Login(ctx, clone2)
+	if err != nil {
+		return err
+	}
+	if secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return fmt.Errorf("No auth data")
+	}
+	secret, err = auth.Login(ctx, clone2)
+	if !isUnwrapRejection(err) {
+		return fmt.Errorf("wrapping token used twice for login: %+v, %v", secret, err)
+	}
+
+	// the wrapping token expires
+	wrappingToken, err = wrapSecretID(ctx, clone2, path, "myrole", "5s")
+	if err != nil {
+		return err
+	}
+	time.Sleep(2 * sleeping)
+	secret, err = clone2.Logical().UnwrapWithContext(ctx, wrappingToken)
+	if !isUnwrapRejection(err) {
+		return fmt.Errorf("wrapping token unwrapped after its TTL: %+v, %v", secret, err)
+	}
+
+	// clean up
+	err = clone2.Sys().DisableAuthWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	for _, ns := range []string{subNS, siblingNS} {
+		_, err = clone.Logical().DeleteWithContext(ctx, "sys/namespaces/"+ns)
+		if err != nil {
+			return err
+		}
+	}
+	time.Sleep(sleeping)
+	client.SetNamespace(os.Getenv("VAULT_NAMESPACE"))
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// unwrapRejection matches the error of unwrapping a wrapping token which is used, expired or unknown.
+var unwrapRejection = regexp.MustCompile(`(?i)wrapping token is not valid or does not exist`)
+
+// isUnwrapRejection tells whether err is the refusal of an unwrap for its wrapping token, rather than
+// a wrong path or a server fault: a 400 naming the invalid wrapping token, or a bare 403 permission denied.
+func isUnwrapRejection(err error) bool {
+	var rErr *api.ResponseError
+	if !errors.As(err, &rErr) {
+		return false
+	}
+	switch rErr.StatusCode {
+	case http.StatusForbidden:
+		return slices.Equal(rErr.Errors, []string{"permission denied"})
+	case http.StatusBadRequest:
+		return slices.ContainsFunc(rErr.Errors, unwrapRejection.MatchString)
+	}
+	return false
+}
+
+// wrapSecretID generates a new secret id of the role, wrapped in a response-wrapping token of the given TTL.
+func wrapSecretID(ctx context.Context, client *api.Client, path, roleName, ttl string) (string, error) {
+	clone, err := newTokenClient(client, client.Token())
+	if err != nil {
+		return "", err
+	}
+	clone.SetWrappingLookupFunc(func(string, string) string {
+		return ttl
+	})
+
+	secret, err := clone.Logical().WriteWithContext(ctx, "auth/"+path+"/role/"+roleName+"/secret-id", nil)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" {
+		return "", fmt.Errorf("no wrap info: %+v", secret)
+	}
+	return secret.WrapInfo.Token, nil
+}
+
+// CheckApproleAccessorRoot checks custom secret ids, secret id accessors and tidying in the root namespace.
+func CheckApproleAccessorRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	return checkApproleAccessors(ctx, client, "approle")
+}
+
+// CheckApproleAccessorNamespace checks custom secret ids, secret id accessors and tidying in the namespace.
+func CheckApproleAccessorNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	err = checkApproleAccessors(ctx, clone, "approle")
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckApproleAccessorMix checks that secret id accessors of the root namespace are meaningless
+// in the namespace, even for an identically named role with the same custom secret id.
+func CheckApproleAccessorMix(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	path := "approle"
+	customID := "my-custom-secret-id"
+	var roleIDs, accessors []string
+	for _, c := range []*api.Client{client, clone} {
+		err = c.Sys().EnableAuthWithOptionsWithContext(ctx, path, &api.EnableAuthOptions{
+			Type: "approle",
+		})
+		if err != nil {
+			return err
+		}
+		time.Sleep(sleeping)
+		roleID, _, err := putApproleRole(ctx, c, path, "myrole", nil)
+		if err != nil {
+			return err
+		}
+		accessor, err := putCustomSecretID(ctx, c, path, "myrole", customID)
+		if err != nil {
+			return err
+		}
+		roleIDs = append(roleIDs, roleID)
+		accessors = append(accessors, accessor)
+	}
+
+	// the accessor of the root namespace is not found in the namespace
+	logicalNS := clone.Logical()
+	secret, err := logicalNS.WriteWithContext(ctx, "auth/"+path+"/role/myrole/secret-id-accessor/lookup", map[string]any{
+		"secret_id_accessor": accessors[0],
+	})
+	if err == nil && secret != nil && secret.Data != nil {
+		return fmt.Errorf("root accessor found in namespace: %+v", secret.Data)
+	}
+	if err != nil && !isAccessorNotFound(err) {
+		return fmt.Errorf("lookup of the root accessor in namespace: %w", err)
+	}
+	_, err = logicalNS.WriteWithContext(ctx, "auth/"+path+"/role/myrole/secret-id-accessor/destroy", map[string]any{
+		"secret_id_accessor": accessors[0],
+	})
+	if !isAccessorNotFound(err) {
+		return fmt.Errorf("root accessor destroyed in namespace: %v", err)
+	}
+
+	// destroying by accessor in the namespace leaves the root namespace alone
+	_, err = logicalNS.WriteWithContext(ctx, "auth/"+path+"/role/myrole/secret-id-accessor/destroy", map[string]any{
+		"secret_id_accessor": accessors[1],
+	})
+	if err != nil {
+		return err
+	}
+	_, err = loginApprole(ctx, clone, path, roleIDs[1], customID)
+	if !isApproleRejection(err) {
+		return fmt.Errorf("destroyed secret id logged in namespace: %v", err)
+	}
+	_, err = loginApprole(ctx, client, path, roleIDs[0], customID)
+	if err != nil {
+		return err
+	}
+
+	// clean up
+	err = clone.Sys().DisableAuthWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	err = client.Sys().DisableAuthWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	client.SetNamespace(os.Getenv("VAULT_NAMESPACE"))
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkApproleAccessors enables AppRole at path in the namespace of client, pushes a custom secret id,
+// then lists, looks up and destroys secret ids by accessor, and tidies the secret ids.
+func checkApproleAccessors(ctx context.Context, client *api.Client, path string) error {
+	logical := client.Logical()
+
+	err := client.Sys().EnableAuthWithOptionsWithContext(ctx, path, &api.EnableAuthOptions{
+		Type: "approle",
+	})
+	if err != nil {
+		return err
+	}
+	time.Sleep(sleeping)
+
+	roleName := "myrole"
+	roleID, secretID, err := putApproleRole(ctx, client, path, roleName, nil)
+	if err != nil {
+		return err
+	}
+	customID := "my-custom-secret-id"
+	accessor, err := putCustomSecretID(ctx, client, path, roleName, customID)
+	if err != nil {
+		return err
+	}
+	_, err = loginApprole(ctx, client, path, roleID, customID)
+	if err != nil {
+		return err
+	}
+
+	accessors, err := listSecretIDAccessors(ctx, client, path, roleName)
+	if err != nil {
+		return err
+	}
+	if len(accessors) != 2 || !slices.Contains(accessors, accessor) {
+		return fmt.Errorf("accessor %s not in %v", accessor, accessors)
+	}
+
+	secret, err := logical.WriteWithContext(ctx, "auth/"+path+"/role/"+roleName+"/secret-id-accessor/lookup", map[string]any{
+		"secret_id_accessor": accessor,
+	})
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["secret_id_accessor"] != accessor {
+		return fmt.Errorf("accessor lookup: %+v", secret)
+	}
+
+	_, err = logical.WriteWithContext(ctx, "auth/"+path+"/role/"+roleName+"/secret-id-accessor/destroy", map[string]any{
+		"secret_id_accessor": accessor,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = loginApprole(ctx, client, path, roleID, customID)
+	if !isApproleRejection(err) {
+		return fmt.Errorf("destroyed secret id logged in: %v", err)
+	}
+	accessors, err = listSecretIDAccessors(ctx, client, path, roleName)
+	if err != nil {
+		return err
+	}
+	if len(accessors) != 1 || slices.Contains(accessors, accessor) {
+		return fmt.Errorf("accessors after destroy: %v", accessors)
+	}
+
+	// tidy keeps the valid secret id
+	_, err = logical.WriteWithContext(ctx, "auth/"+path+"/tidy/secret-id", nil)
+	if err != nil {
+		return err
+	}
+	time.Sleep(sleeping)
+	_, err = loginApprole(ctx, client, path, roleID, secretID)
+	if err != nil {
+		return err
+	}
+
+	return client.Sys().DisableAuthWithContext(ctx, path)
+}
+
+// accessorNotFound matches the error of a secret id accessor unknown to the role.
+var accessorNotFound = regexp.MustCompile(`failed to find accessor entry`)
+
+// isAccessorNotFound tells whether err is the refusal of a secret id accessor unknown to the role, rather than
+// a wrong path or another fault. The lookup answers it with 400 or 404, but the destroy with a bare 500, so the
+// status is only trusted together with the message.
+func isAccessorNotFound(err error) bool {
+	var rErr *api.ResponseError
+	if !errors.As(err, &rErr) {
+		return false
+	}
+	switch rErr.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError:
+		return slices.ContainsFunc(rErr.Errors, accessorNotFound.MatchString)
+	}
+	return false
+}
+
+// putCustomSecretID pushes the custom secret id to the role and returns its accessor.
+func putCustomSecretID(ctx context.Context, client *api.Client, path, roleName, secretID string) (string, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, "auth/"+path+"/role/"+roleName+"/custom-secret-id", map[string]any{
+		"secret_id": secretID,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["secret_id"] != secretID {
+		return "", fmt.Errorf("custom secret id: %+v", secret)
+	}
+	return secret.Data["secret_id_accessor"].(string), nil
+}
+
+// listSecretIDAccessors lists the secret id accessors of the role.
+func listSecretIDAccessors(ctx context.Context, client *api.Client, path, roleName string) ([]string, error) {
+	secret, err := client.Logical().ListWithContext(ctx, "auth/"+path+"/role/"+roleName+"/secret-id")
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["keys"] == nil {
+		return nil, nil
+	}
+	var accessors []string
+	for _, k := range secret.Data["keys"].([]any) {
+		accessors = append(accessors, k.(string))
+	}
+	return accessors, nil
+}
+
+// checkApproleConstraints enables AppRole at path in the namespace of client, and checks
+// that logins and tokens fail once the limits of the role are hit.
+func checkApproleConstraints(ctx context.Context, client *api.Client, path string) error {
+	err := client.Sys().EnableAuthWithOptionsWithContext(ctx, path, &api.EnableAuthOptions{
+		Type: "approle",
+	})
+	if err != nil {
+		return err
+	}
+	time.Sleep(sleeping)
+
+	// a secret id can be used twice
+	roleID, secretID, err := putApproleRole(ctx, client, path, "numuses", map[string]any{
+		"secret_id_num_uses": 2,
+	})
+	if err != nil {
+		return err
+	}
+	for range 2 {
+		_, err = loginApprole(ctx, client, path, roleID, secretID)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = loginApprole(ctx, client, path, roleID, secretID)
+	if !isApproleRejection(err) {
+		return fmt.Errorf("secret id used more than secret_id_num_uses: %v", err)
+	}
+
+	// a secret id expires
+	roleID, secretID, err = putApproleRole(ctx, client, path, "ttl", map[string]any{
+		"secret_id_ttl": "5s",
+	})
+	if err != nil {
+		return err
+	}
+	_, err = loginApprole(ctx, client, path, roleID, secretID)
+	if err != nil {
+		return err
+	}
+	time.Sleep(2 * sleeping)
+	_, err = loginApprole(ctx, client, path, roleID, secretID)
+	if !isApproleRejection(err) {
+		return fmt.Errorf("secret id used after secret_id_ttl: %v", err)
+	}
+
+	// a token can be used twice
+	roleID, secretID, err = putApproleRole(ctx, client, path, "tokenuses", map[string]any{
+		"token_num_uses": 2,
+	})
+	if err != nil {
+		return err
+	}
+	token, err := loginApprole(ctx, client, path, roleID, secretID)
+	if err != nil {
+		return err
+	}
+	err = checkTokenUses(ctx, client, token, 2)
+	if err != nil {
+		return err
+	}
+
+	// no secret id is needed, but the source address is still bound
+	roleID, _, err = putApproleRole(ctx, client, path, "nosecret", map[string]any{
+		"bind_secret_id":        false,
+		"secret_id_bound_cidrs": []string{"0.0.0.0/0", "::/0"},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = loginApprole(ctx, client, path, roleID, "")
+	if err != nil {
+		return err
+	}
+
+	// the secret id is bound to an address we are not calling from
+	roleID, secretID, err = putApproleRole(ctx, client, path, "secretcidr", map[string]any{
+		"secret_id_bound_cidrs": []string{"192.0.2.0/24"},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = loginApprole(ctx, client, path, roleID, secretID)
+	if !isCIDRRejection(err) {
+		return fmt.Errorf("login outside secret_id_bound_cidrs: %v", err)
+	}
+
+	// the token is bound to an address we are not calling from
+	roleID, secretID, err = putApproleRole(ctx, client, path, "tokencidr", map[string]any{
+		"token_bound_cidrs": []string{"192.0.2.0/24"},
+	})
+	if err != nil {
+		return err
+	}
+	token, err = loginApprole(ctx, client, path, roleID, secretID)
+	if err != nil {
+		return err
+	}
+	err = checkTokenUses(ctx, client, token, 0)
+	if err != nil {
+		return err
+	}
+
+	return client.Sys().DisableAuthWithContext(ctx, path)
+}
+
+// putApproleRole writes the role with the given options at path, and returns its role id
+// and a new secret id. No secret id is generated if the role does not bind one.
+func putApproleRole(ctx context.Context, client *api.Client, path, roleName string, options map[string]any) (roleID, secretID string, err error) {
+	logical := client.Logical()
+
+	data := map[string]any{
+		"policies": []string{"default"},
+	}
+	for k, v := range options {
+		data[k] = v
+	}
+	_, err = logical.WriteWithContext(ctx, "auth/"+path+"/role/"+roleName, data)
+	if err != nil {
+		return "", "", err
+	}
+
+	secret, err := logical.ReadWithContext(ctx, "auth/"+path+"/role/"+roleName+"/role-id")
+	if err != nil {
+		return "", "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return "", "", fmt.Errorf("no role id for %s", roleName)
+	}
+	roleID = secret.Data["role_id"].(string)
+
+	if bind, ok := options["bind_secret_id"]; ok && bind == false {
+		return roleID, "", nil
+	}
+	secret, err = logical.WriteWithContext(ctx, "auth/"+path+"/role/"+roleName+"/secret-id", nil)
+	if err != nil {
+		return "", "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return "", "", fmt.Errorf("no secret id for %s", roleName)
+	}
+	secretID = secret.Data["secret_id"].(string)
+	return roleID, secretID, nil
+}
+
+// loginApprole logs in with the role id and the secret id, which may be empty, and returns the client token.
+func loginApprole(ctx context.Context, client *api.Client, path, roleID, secretID string) (string, error) {
+	data := map[string]any{
+		"role_id": roleID,
+	}
+	if secretID != "" {
+		data["secret_id"] = secretID
+	}
+	secret, err := client.Logical().WriteWithContext(ctx, "auth/"+path+"/login", data)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return "", fmt.Errorf("No auth data: %+v", secret)
+	}
+	return secret.Auth.ClientToken, nil
+}
+
+// approleRejection matches the error of an AppRole login with a role id or a secret id which is unknown,
+// used up or expired.
+var approleRejection = regexp.MustCompile(`(?i)invalid (role or secret id|secret id|role id)`)
+
+// isApproleRejection tells whether err is the refusal of an AppRole login for its role id or secret id,
+// rather than a wrong mount or a server fault: a 400 naming the invalid id, or a bare 403 permission denied.
+func isApproleRejection(err error) bool {
+	var rErr *api.ResponseError
+	if !errors.As(err, &rErr) {
+		return false
+	}
+	switch rErr.StatusCode {
+	case http.StatusForbidden:
+		return slices.Equal(rErr.Errors, []string{"permission denied"})
+	case http.StatusBadRequest:
+		return slices.ContainsFunc(rErr.Errors, approleRejection.MatchString)
+	}
+	return false
+}
+
+// checkTokenUses checks that the token can make exactly uses requests in the namespace of client.
+func checkTokenUses(ctx context.Context, client *api.Client, token string, uses int) error {
+	tokenClient, err := newTokenClient(client, token)
+	if err != nil {
+		return err
+	}
+	for i := range uses {
+		ok, err := isTokenValid(ctx, tokenClient)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("token denied at use %d of %d", i+1, uses)
+		}
+	}
+	ok, err := isTokenValid(ctx, tokenClient)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return fmt.Errorf("token used more than %d times", uses)
+	}
+	return nil
+}
+
 func getApprole(client *api.Client, ctx context.Context, path, roleName string, policies ...string) (roleID, secretID, token string, err error) {
 	if len(policies) == 0 {
 		policies = []string{"default"}
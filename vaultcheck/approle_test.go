@@ -42,3 +42,94 @@ func TestApproleMix(t *testing.T) {
 		t.Fatalf("ApproleMix failed: %v", err)
 	}
 }
+
+// TestApproleConstraintsRoot tests the secret-id and token constraints of AppRole roles at the root namespace.
+func TestApproleConstraintsRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckApproleConstraintsRoot(client)
+	if err != nil {
+		t.Fatalf("ApproleConstraintsRoot failed: %v", err)
+	}
+}
+
+// TestApproleConstraintsNamespace tests the secret-id and token constraints of AppRole roles in a specific namespace.
+func TestApproleConstraintsNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckApproleConstraintsNamespace(client)
+	if err != nil {
+		t.Fatalf("ApproleConstraintsNamespace failed: %v", err)
+	}
+}
+
+// TestApproleConstraintsMix tests that identically named AppRole roles in mixed namespaces have independent constraints.
+func TestApproleConstraintsMix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckApproleConstraintsMix(client)
+	if err != nil {
+		t.Fatalf("ApproleConstraintsMix failed: %v", err)
+	}
+}
+
+// TestApproleWrapped tests the delivery of response-wrapped AppRole secret ids across namespaces.
+func TestApproleWrapped(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckApproleWrapped(client)
+	if err != nil {
+		t.Fatalf("ApproleWrapped failed: %v", err)
+	}
+}
+
+// TestApproleAccessorRoot tests the management of AppRole secret ids by accessor at the root namespace.
+func TestApproleAccessorRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckApproleAccessorRoot(client)
+	if err != nil {
+		t.Fatalf("ApproleAccessorRoot failed: %v", err)
+	}
+}
+
+// TestApproleAccessorNamespace tests the management of AppRole secret ids by accessor in a specific namespace.
+func TestApproleAccessorNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckApproleAccessorNamespace(client)
+	if err != nil {
+		t.Fatalf("ApproleAccessorNamespace failed: %v", err)
+	}
+}
+
+// TestApproleAccessorMix tests that AppRole secret id accessors do not cross namespaces.
+func TestApproleAccessorMix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckApproleAccessorMix(client)
+	if err != nil {
+		t.Fatalf("ApproleAccessorMix failed: %v", err)
+	}
+}
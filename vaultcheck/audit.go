@@ -0,0 +1,234 @@
+package vaultcheck
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// AuditDirEnv names the environment variable holding the directory of the file audit log. The server
+// writes the log, and the check reads it, so the directory must be shared, e.g. with a local server.
+const AuditDirEnv = "NSCHECK_AUDIT_DIR"
+
+// auditEntry is the part of a JSON line of the file audit log used by the checks.
+type auditEntry struct {
+	Type    string `json:"type"`
+	Request struct {
+		Operation string `json:"operation"`
+		Path      string `json:"path"`
+		Namespace struct {
+			ID   string `json:"id"`
+			Path string `json:"path"`
+		} `json:"namespace"`
+		Data map[string]any `json:"data"`
+	} `json:"request"`
+	Response struct {
+		Data map[string]any `json:"data"`
+	} `json:"response"`
+}
+
+// CheckAudit enables a file audit device in the root namespace, and in the namespace unless the server profile
+// declares it unsupported, then writes and reads a KV1 secret in both namespaces. Every request and response
+// must be logged with its namespace, with the secret HMACed as by sys/audit-hash and never in plaintext.
+func CheckAudit(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	dir := os.Getenv(AuditDirEnv)
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	fn := filepath.Join(dir, fmt.Sprintf("nscheck-audit-%d.log", time.Now().UnixNano()))
+	device := "nscheck"
+	err = client.Sys().EnableAuditWithOptionsWithContext(ctx, device, &api.EnableAuditOptions{
+		Type: "file",
+		Options: map[string]string{
+			"file_path": fn,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	// an audit device in the namespace, unless the server profile declares them restricted to the root namespace
+	unsupported, err := expectsError(ctx, client, errNamespaceAudit)
+	if err != nil {
+		return err
+	}
+	nsFn := filepath.Join(dir, fmt.Sprintf("nscheck-audit-%s-%d.log", rootNS, time.Now().UnixNano()))
+	err = clone.Sys().EnableAuditWithOptionsWithContext(ctx, device, &api.EnableAuditOptions{
+		Type: "file",
+		Options: map[string]string{
+			"file_path": nsFn,
+		},
+	})
+	switch {
+	case unsupported:
+		err = checkExpectedError(ctx, client, errNamespaceAudit, err)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+	nsDevice := !unsupported
+
+	path := "auditkv"
+	secrets := make(map[string]string)
+	for _, c := range []*api.Client{client, clone} {
+		err = c.Sys().MountWithContext(ctx, path, &api.MountInput{
+			Type: "kv",
+		})
+		if err != nil {
+			return err
+		}
+		time.Sleep(sleeping)
+		value := "s3cr3t-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+		secrets[auditNamespace(c)] = value
+		_, err = c.Logical().WriteWithContext(ctx, path+"/mysecret", map[string]any{
+			"password": value,
+		})
+		if err != nil {
+			return err
+		}
+		secret, err := c.Logical().ReadWithContext(ctx, path+"/mysecret")
+		if err != nil {
+			return err
+		}
+		if secret == nil || secret.Data == nil || secret.Data["password"] != value {
+			return fmt.Errorf("secret in %q: %+v", c.Namespace(), secret)
+		}
+	}
+	time.Sleep(sleeping)
+
+	err = checkAuditLog(ctx, client, device, fn, path+"/mysecret", secrets)
+	if err != nil {
+		return err
+	}
+	if nsDevice {
+		// the device of the namespace only logs the namespace
+		err = checkAuditLog(ctx, clone, device, nsFn, path+"/mysecret", map[string]string{
+			auditNamespace(clone): secrets[auditNamespace(clone)],
+		})
+		if err != nil {
+			return err
+		}
+		err = clone.Sys().DisableAuditWithContext(ctx, device)
+		if err != nil {
+			return err
+		}
+	}
+
+	// clean up
+	err = client.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	err = client.Sys().DisableAuditWithContext(ctx, device)
+	if err != nil {
+		return err
+	}
+	os.Remove(fn)
+	os.Remove(nsFn)
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkAuditLog parses the audit log in fn and checks that the write and read of the secret at path
+// are logged, as request and response, exactly in the namespaces of secrets, which maps each namespace
+// to the plaintext secret written there. The HMACs must be those of the audit device.
+func checkAuditLog(ctx context.Context, client *api.Client, device, fn, path string, secrets map[string]string) error {
+	bs, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	for ns, value := range secrets {
+		if strings.Contains(string(bs), value) {
+			return fmt.Errorf("plaintext secret of %q in the audit log %s", ns, fn)
+		}
+	}
+	if strings.Contains(string(bs), client.Token()) {
+		return fmt.Errorf("plaintext token in the audit log %s", fn)
+	}
+
+	hashes := make(map[string]string)
+	for ns, value := range secrets {
+		hashes[ns], err = client.Sys().AuditHashWithContext(ctx, device, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the count of requests and responses of each operation in each namespace
+	counts := make(map[string]int)
+	scanner := bufio.NewScanner(strings.NewReader(string(bs)))
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		entry := new(auditEntry)
+		err = json.Unmarshal(scanner.Bytes(), entry)
+		if err != nil {
+			return fmt.Errorf("audit log %s: %w", fn, err)
+		}
+		if entry.Request.Path != path {
+			continue
+		}
+		ns := entry.Request.Namespace.Path
+		hash, ok := hashes[ns]
+		if !ok {
+			return fmt.Errorf("%s %s of %s logged in namespace %q", entry.Type, entry.Request.Operation, path, ns)
+		}
+		counts[ns+" "+entry.Request.Operation+" "+entry.Type]++
+
+		var data map[string]any
+		switch {
+		case entry.Type == "request" && entry.Request.Operation == "update":
+			data = entry.Request.Data
+		case entry.Type == "response" && entry.Request.Operation == "read":
+			data = entry.Response.Data
+		default:
+			continue
+		}
+		if data["password"] != hash {
+			return fmt.Errorf("%s %s in %q: password %v, expected %s", entry.Type, entry.Request.Operation, ns, data["password"], hash)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	for ns := range secrets {
+		for _, op := range []string{"update", "read"} {
+			for _, typ := range []string{"request", "response"} {
+				if counts[ns+" "+op+" "+typ] != 1 {
+					return fmt.Errorf("%d %s %s of %s logged in %q", counts[ns+" "+op+" "+typ], op, typ, path, ns)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// auditNamespace returns the namespace of client as logged in the audit log: empty for the root namespace,
+// otherwise with a trailing slash.
+func auditNamespace(client *api.Client) string {
+	ns := strings.Trim(client.Namespace(), "/")
+	if ns == "" {
+		return ""
+	}
+	return ns + "/"
+}
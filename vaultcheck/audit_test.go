@@ -0,0 +1,18 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestAudit tests that the file audit log records the namespace and HMACs the secrets of each request.
+func TestAudit(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckAudit(client)
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+package vaultcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// ACLModeEnv names the environment variable which selects how ACL checks assert permissions:
+// "capabilities" queries sys/capabilities-self and sys/capabilities-accessor, anything else
+// attempts real reads and writes.
+const ACLModeEnv = "NSCHECK_ACL_MODE"
+
+// aclAssertion asserts what the token of client can do on the KV2 secret title at path.
+type aclAssertion func(ctx context.Context, client *api.Client, path, title string) error
+
+// getACLAssertions returns the read-not-write and the read-and-write assertions of the ACL mode.
+// The capabilities mode queries sys/capabilities-accessor with rootToken.
+func getACLAssertions(rootToken string) (aclAssertion, aclAssertion) {
+	if os.Getenv(ACLModeEnv) == "capabilities" {
+		return func(ctx context.Context, client *api.Client, path, title string) error {
+				return capabilitiesReadNotWrite(ctx, client, rootToken, path, title)
+			}, func(ctx context.Context, client *api.Client, path, title string) error {
+				return capabilitiesReadAndWrite(ctx, client, rootToken, path, title)
+			}
+	}
+	return canReadNotWriteTitle, canReadAndWriteTitle
+}
+
+// CheckCapabilities compares the capabilities reported by sys/capabilities-self and sys/capabilities-accessor
+// to the behaviour observed when reading and writing, for read and write tokens of the root namespace,
+// ns1 and ns1/ns2 on a KV2 secret in each of these namespaces. All disagreements are reported as a table.
+func CheckCapabilities(client *api.Client) error {
+	ctx := context.Background()
+
+	rootToken := client.Token()
+
+	path := "mountPath"
+	title := "mysecret"
+	readACL := "userread"
+	writeACL := "userwrite"
+
+	type tokenInfo struct {
+		name     string
+		ns       string
+		token    string
+		accessor string
+	}
+	var tokens []tokenInfo
+
+	namespaces := []string{"", "ns1", "ns1/ns2"}
+	clients := map[string]*api.Client{"": client}
+	for _, ns := range namespaces {
+		if ns != "" {
+			parent, name := splitNamespace(ns)
+			clone, err := cloneClient(ctx, clients[parent], name)
+			if err != nil {
+				return err
+			}
+			clients[ns] = clone
+		}
+		c := clients[ns]
+		err := createKV2Secret(ctx, c, path, title, "myadmin", "123456")
+		if err != nil {
+			return err
+		}
+		for name, policy := range map[string]string{readACL: getPowerRead(path), writeACL: getPowerWrite(path)} {
+			err = c.Sys().PutPolicyWithContext(ctx, name, policy)
+			if err != nil {
+				return err
+			}
+			_, secret, err := getTokenAuthSecret(ctx, c, rootToken, name)
+			if err != nil {
+				return err
+			}
+			tokens = append(tokens, tokenInfo{name, ns, secret.Auth.ClientToken, secret.Auth.Accessor})
+		}
+	}
+
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOKEN\tTOKEN NS\tREQUEST NS\tSELF\tACCESSOR\tOBSERVED")
+	disagreements := 0
+	for _, t := range tokens {
+		home := clients[t.ns]
+		for _, requestNS := range namespaces {
+			// the capabilities are reported in the namespace of the token, relative to it
+			var self, byAccessor []string
+			if relative, ok := relativeNamespace(t.ns, requestNS); ok {
+				tokenClient, err := newTokenClient(home, t.token)
+				if err != nil {
+					return err
+				}
+				self, err = tokenClient.Sys().CapabilitiesSelfWithContext(ctx, relative+path+"/data/"+title)
+				if err != nil {
+					return err
+				}
+				byAccessor, err = capabilitiesAccessor(ctx, home, t.accessor, relative+path+"/data/"+title)
+				if err != nil {
+					return err
+				}
+			}
+
+			observed, err := observeCapabilities(ctx, clients[requestNS], t.token, path, title)
+			if err != nil {
+				return err
+			}
+
+			reported := []bool{slices.Contains(self, "read"), canWrite(self)}
+			if !slices.Equal(reported, []bool{slices.Contains(byAccessor, "read"), canWrite(byAccessor)}) ||
+				!slices.Equal(reported, observed) {
+				disagreements++
+				fmt.Fprintf(w, "%s\t%q\t%q\t%v\t%v\t%v\n", t.name, t.ns, requestNS, self, byAccessor, observed)
+			}
+		}
+	}
+	w.Flush()
+
+	// clean up
+	for i := len(namespaces) - 1; i >= 0; i-- {
+		ns := namespaces[i]
+		c := clients[ns]
+		c.SetToken(rootToken)
+		err := c.Sys().UnmountWithContext(ctx, path)
+		if err != nil {
+			return err
+		}
+		if ns == "" {
+			for _, name := range []string{readACL, writeACL} {
+				err = c.Sys().DeletePolicyWithContext(ctx, name)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		parent, name := splitNamespace(ns)
+		_, err = clients[parent].Logical().DeleteWithContext(ctx, "sys/namespaces/"+name)
+		if err != nil {
+			return err
+		}
+		time.Sleep(sleeping)
+	}
+
+	if disagreements > 0 {
+		return fmt.Errorf("%d disagreements between reported and enforced capabilities:\n%s", disagreements, table.String())
+	}
+	return nil
+}
+
+// capabilitiesAccessor returns the capabilities on path of the token with the given accessor,
+// queried in the namespace of client.
+func capabilitiesAccessor(ctx context.Context, client *api.Client, accessor, path string) ([]string, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, "sys/capabilities-accessor", map[string]any{
+		"accessor": accessor,
+		"paths":    []string{path},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil || secret.Data[path] == nil {
+		return nil, fmt.Errorf("capabilities of %s: %+v", path, secret)
+	}
+	var capabilities []string
+	for _, c := range secret.Data[path].([]any) {
+		capabilities = append(capabilities, c.(string))
+	}
+	return capabilities, nil
+}
+
+// observeCapabilities attempts to read the KV2 secret title at path, and to write a new one,
+// with the token in the namespace of client. It returns whether each was allowed.
+func observeCapabilities(ctx context.Context, client *api.Client, token, path, title string) ([]bool, error) {
+	tokenClient, err := newTokenClient(client, token)
+	if err != nil {
+		return nil, err
+	}
+	kv2 := tokenClient.KVv2(path)
+
+	_, err = kv2.Get(ctx, title)
+	if err != nil && !strings.Contains(err.Error(), "permission denied") {
+		return nil, err
+	}
+	read := err == nil
+
+	_, err = kv2.Put(ctx, title+"1", map[string]any{
+		"username": "myadmin1",
+		"password": "1234567",
+	})
+	if err != nil && !strings.Contains(err.Error(), "permission denied") {
+		return nil, err
+	}
+	return []bool{read, err == nil}, nil
+}
+
+// canWrite reports whether the capabilities allow writing a KV2 secret.
+func canWrite(capabilities []string) bool {
+	return slices.Contains(capabilities, "root") ||
+		(slices.Contains(capabilities, "create") && slices.Contains(capabilities, "update"))
+}
+
+// capabilitiesError is a capability missing from those reported by sys/capabilities-self and sys/capabilities-accessor.
+type capabilitiesError struct {
+	capabilities []string
+	path         string
+	expected     []string
+}
+
+func (e *capabilitiesError) Error() string {
+	return fmt.Sprintf("capabilities %v on %s, expected %v", e.capabilities, e.path, e.expected)
+}
+
+// isDenied tells whether err is a permission denied by the server, or a capability missing
+// as asserted in the capabilities ACL mode.
+func isDenied(err error) bool {
+	var cErr *capabilitiesError
+	return errors.As(err, &cErr) || (err != nil && strings.Contains(err.Error(), "permission denied"))
+}
+
+// reportedCapabilities returns the capabilities on path of the token of client reported by sys/capabilities-self,
+// and checks that sys/capabilities-accessor, queried with rootToken, reports the same.
+func reportedCapabilities(ctx context.Context, client *api.Client, rootToken, path string) ([]string, error) {
+	self, err := client.Sys().CapabilitiesSelfWithContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// the accessor is only known in the namespace of the token, which is the namespace of client
+	// or one of its ancestors, where path is prefixed by the namespaces in between
+	ns, relative := client.Namespace(), ""
+	var byAccessor []string
+	for {
+		home, err := newTokenClient(client, client.Token())
+		if err != nil {
+			return nil, err
+		}
+		if ns == "" {
+			home.ClearNamespace()
+		} else {
+			home.SetNamespace(ns)
+		}
+		byAccessor, err = homeCapabilities(ctx, home, rootToken, relative+path)
+		if err == nil {
+			break
+		}
+		if rErr, ok := err.(*api.ResponseError); ns == "" || !ok || (rErr.StatusCode != 400 && rErr.StatusCode != 403) {
+			return nil, err
+		}
+		parent, name := splitNamespace(ns)
+		ns, relative = parent, name+"/"+relative
+	}
+
+	if !slices.Equal(slices.Sorted(slices.Values(self)), slices.Sorted(slices.Values(byAccessor))) {
+		return nil, fmt.Errorf("capabilities on %s: %v by capabilities-self, %v by capabilities-accessor", path, self, byAccessor)
+	}
+	return self, nil
+}
+
+// homeCapabilities looks up the accessor of the token of client in the namespace of client,
+// and returns the capabilities on path reported for it by sys/capabilities-accessor with rootToken.
+func homeCapabilities(ctx context.Context, client *api.Client, rootToken, path string) ([]string, error) {
+	secret, err := client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	accessor, err := secret.TokenAccessor()
+	if err != nil {
+		return nil, err
+	}
+	rootClient, err := newTokenClient(client, rootToken)
+	if err != nil {
+		return nil, err
+	}
+	return capabilitiesAccessor(ctx, rootClient, accessor, path)
+}
+
+// capabilitiesReadNotWrite asserts with sys/capabilities-self and sys/capabilities-accessor that the client can read
+// the secret title at path, but cannot write another secret.
+func capabilitiesReadNotWrite(ctx context.Context, client *api.Client, rootToken, path, title string) error {
+	capabilities, err := reportedCapabilities(ctx, client, rootToken, path+"/data/"+title)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(capabilities, "read") {
+		return &capabilitiesError{capabilities, title, []string{"read"}}
+	}
+	capabilities, err = reportedCapabilities(ctx, client, rootToken, path+"/data/"+title+"1")
+	if err != nil {
+		return err
+	}
+	if canWrite(capabilities) {
+		return fmt.Errorf("capabilities %v on %s allow writing", capabilities, title+"1")
+	}
+	return nil
+}
+
+// capabilitiesReadAndWrite asserts with sys/capabilities-self and sys/capabilities-accessor that the client can read
+// the secret title at path, and can write another secret.
+func capabilitiesReadAndWrite(ctx context.Context, client *api.Client, rootToken, path, title string) error {
+	capabilities, err := reportedCapabilities(ctx, client, rootToken, path+"/data/"+title)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(capabilities, "read") {
+		return &capabilitiesError{capabilities, title, []string{"read"}}
+	}
+	capabilities, err = reportedCapabilities(ctx, client, rootToken, path+"/data/"+title+"1")
+	if err != nil {
+		return err
+	}
+	if !canWrite(capabilities) {
+		return &capabilitiesError{capabilities, title + "1", []string{"create", "update"}}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestCapabilities tests that the reported capabilities of tokens match the enforced ones across namespaces.
+func TestCapabilities(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckCapabilities(client)
+	if err != nil {
+		t.Fatalf("Capabilities failed: %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package vaultcheck
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"slices"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// CheckCubbyholeRoot checks that tokens of the root namespace only see their own cubbyhole.
+func CheckCubbyholeRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	return checkCubbyhole(ctx, client)
+}
+
+// CheckCubbyholeNamespace checks that tokens of the namespace only see their own cubbyhole.
+func CheckCubbyholeNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	err = checkCubbyhole(ctx, clone)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckCubbyholeMix checks that the root token, though it manages the namespace, cannot read
+// the cubbyhole of a token of the namespace, and that the token cannot read the cubbyhole of
+// a token of the root namespace.
+func CheckCubbyholeMix(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	rootToken := client.Token()
+	rootClient, err := createChildToken(ctx, client, rootToken, "default")
+	if err != nil {
+		return err
+	}
+	nsClient, err := createChildToken(ctx, clone, rootToken, "default")
+	if err != nil {
+		return err
+	}
+	err = writeCubbyhole(ctx, rootClient, "secret", "root")
+	if err != nil {
+		return err
+	}
+	err = writeCubbyhole(ctx, nsClient, "secret", "pname")
+	if err != nil {
+		return err
+	}
+
+	// the root token has its own cubbyhole in the namespace
+	value, err := readCubbyhole(ctx, clone, "secret")
+	if err != nil {
+		return err
+	}
+	if value != "" {
+		return fmt.Errorf("root token read the cubbyhole of the token of %s: %s", rootNS, value)
+	}
+	err = writeCubbyhole(ctx, clone, "secret", "overwritten")
+	if err != nil {
+		return err
+	}
+	value, err = readCubbyhole(ctx, nsClient, "secret")
+	if err != nil {
+		return err
+	}
+	if value != "pname" {
+		return fmt.Errorf("cubbyhole of the token of %s: %s", rootNS, value)
+	}
+
+	// the token of the namespace has no access to the root namespace
+	rootNSClient, err := newTokenClient(client, nsClient.Token())
+	if err != nil {
+		return err
+	}
+	value, err = readCubbyhole(ctx, rootNSClient, "secret")
+	if err == nil {
+		return fmt.Errorf("token of %s read a cubbyhole in the root namespace: %s", rootNS, value)
+	}
+	value, err = readCubbyhole(ctx, rootClient, "secret")
+	if err != nil {
+		return err
+	}
+	if value != "root" {
+		return fmt.Errorf("cubbyhole of the token of the root namespace: %s", value)
+	}
+
+	// clean up
+	_, err = clone.Logical().DeleteWithContext(ctx, "cubbyhole/secret")
+	if err != nil {
+		return err
+	}
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return client.Auth().Token().RevokeTreeWithContext(ctx, rootClient.Token())
+}
+
+// checkCubbyhole creates two tokens in the namespace of client, and checks that each token,
+// and the root token, only read and list their own cubbyhole, and that the cubbyhole data of
+// a revoked token is gone: a token recreated with the same ID finds an empty cubbyhole, while
+// the cubbyhole of the other token is untouched.
+func checkCubbyhole(ctx context.Context, client *api.Client) error {
+	rootToken := client.Token()
+	tokens := make(map[string]*api.Client)
+	ids := make(map[string]string)
+	for _, name := range []string{"alice", "bob"} {
+		ids[name] = rand.Text()
+		tokenClient, err := createTokenWithID(ctx, client, rootToken, ids[name])
+		if err != nil {
+			return err
+		}
+		tokens[name] = tokenClient
+		err = writeCubbyhole(ctx, tokenClient, "secret", name)
+		if err != nil {
+			return err
+		}
+		err = writeCubbyhole(ctx, tokenClient, name, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, tokenClient := range tokens {
+		value, err := readCubbyhole(ctx, tokenClient, "secret")
+		if err != nil {
+			return err
+		}
+		if value != name {
+			return fmt.Errorf("cubbyhole of %s: %s", name, value)
+		}
+		secret, err := tokenClient.Logical().ListWithContext(ctx, "cubbyhole")
+		if err != nil {
+			return err
+		}
+		if secret == nil || secret.Data == nil || secret.Data["keys"] == nil {
+			return fmt.Errorf("list of the cubbyhole of %s: %+v", name, secret)
+		}
+		keys := secret.Data["keys"].([]any)
+		if len(keys) != 2 || !slices.Contains(keys, any("secret")) || !slices.Contains(keys, any(name)) {
+			return fmt.Errorf("list of the cubbyhole of %s: %v", name, keys)
+		}
+	}
+
+	value, err := readCubbyhole(ctx, client, "secret")
+	if err != nil {
+		return err
+	}
+	if value != "" {
+		return fmt.Errorf("root token read the cubbyhole of a token: %s", value)
+	}
+
+	// once alice is revoked, her token no longer reaches a cubbyhole, a token recreated
+	// with her ID finds her cubbyhole empty, and bob's is untouched
+	err = client.Auth().Token().RevokeTreeWithContext(ctx, tokens["alice"].Token())
+	if err != nil {
+		return err
+	}
+	value, err = readCubbyhole(ctx, tokens["alice"], "secret")
+	if err == nil {
+		return fmt.Errorf("revoked token read its cubbyhole: %s", value)
+	}
+	recreated, err := createTokenWithID(ctx, client, rootToken, ids["alice"])
+	if err != nil {
+		return err
+	}
+	if recreated.Token() != tokens["alice"].Token() {
+		return fmt.Errorf("token recreated as %s, revoked %s", recreated.Token(), tokens["alice"].Token())
+	}
+	value, err = readCubbyhole(ctx, recreated, "secret")
+	if err != nil {
+		return err
+	}
+	if value != "" {
+		return fmt.Errorf("cubbyhole of alice survived her revocation: %s", value)
+	}
+	err = client.Auth().Token().RevokeTreeWithContext(ctx, recreated.Token())
+	if err != nil {
+		return err
+	}
+	value, err = readCubbyhole(ctx, tokens["bob"], "secret")
+	if err != nil {
+		return err
+	}
+	if value != "bob" {
+		return fmt.Errorf("cubbyhole of bob after revoking alice: %s", value)
+	}
+
+	return client.Auth().Token().RevokeTreeWithContext(ctx, tokens["bob"].Token())
+}
+
+// createTokenWithID creates, with rootToken, a token of the given ID and the default policy in the namespace
+// of client, and returns a new client holding the token in the same namespace.
+func createTokenWithID(ctx context.Context, client *api.Client, rootToken, id string) (*api.Client, error) {
+	client.SetToken(rootToken)
+
+	secret, err := client.Auth().Token().CreateWithContext(ctx, &api.TokenCreateRequest{
+		ID:       id,
+		Policies: []string{"default"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("Auth data: %+v", secret.Auth)
+	}
+	return newTokenClient(client, secret.Auth.ClientToken)
+}
+
+// writeCubbyhole writes the value under the key in the cubbyhole of the token of client.
+func writeCubbyhole(ctx context.Context, client *api.Client, key, value string) error {
+	_, err := client.Logical().WriteWithContext(ctx, "cubbyhole/"+key, map[string]any{
+		"value": value,
+	})
+	return err
+}
+
+// readCubbyhole reads the value under the key in the cubbyhole of the token of client,
+// or an empty string if there is none.
+func readCubbyhole(ctx context.Context, client *api.Client, key string) (string, error) {
+	secret, err := client.Logical().ReadWithContext(ctx, "cubbyhole/"+key)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["value"] == nil {
+		return "", nil
+	}
+	return secret.Data["value"].(string), nil
+}
@@ -0,0 +1,44 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestCubbyholeRoot tests the cubbyhole isolation of tokens at the root namespace.
+func TestCubbyholeRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckCubbyholeRoot(client)
+	if err != nil {
+		t.Fatalf("CubbyholeRoot failed: %v", err)
+	}
+}
+
+// TestCubbyholeNamespace tests the cubbyhole isolation of tokens in a specific namespace.
+func TestCubbyholeNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckCubbyholeNamespace(client)
+	if err != nil {
+		t.Fatalf("CubbyholeNamespace failed: %v", err)
+	}
+}
+
+// TestCubbyholeMix tests that a root token cannot read the cubbyhole of a token in a child namespace.
+func TestCubbyholeMix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckCubbyholeMix(client)
+	if err != nil {
+		t.Fatalf("CubbyholeMix failed: %v", err)
+	}
+}
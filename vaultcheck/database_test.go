@@ -0,0 +1,31 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestDatabaseNamespace tests the database secrets engine against PostgreSQL in a specific namespace.
+func TestDatabaseNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckDatabaseNamespace(client)
+	if err != nil {
+		t.Fatalf("DatabaseNamespace failed: %v", err)
+	}
+}
+
+// TestDatabaseSibling tests that the database connection of a namespace is invisible to a sibling namespace.
+func TestDatabaseSibling(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckDatabaseSibling(client)
+	if err != nil {
+		t.Fatalf("DatabaseSibling failed: %v", err)
+	}
+}
@@ -0,0 +1,536 @@
+package vaultcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// CheckIdentityRoot checks entities, aliases, internal and external groups, and group policies in the root namespace.
+func CheckIdentityRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	_, err := setupIdentity(ctx, client)
+	if err != nil {
+		return err
+	}
+	return dropIdentity(ctx, client)
+}
+
+// CheckIdentityNamespace checks entities, aliases, internal and external groups, and group policies in the namespace.
+func CheckIdentityNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	_, err = setupIdentity(ctx, clone)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckIdentityMix checks that group-granted policies apply only within their namespace, and that
+// groups and entity merges cannot reach the entities of another namespace.
+func CheckIdentityMix(client *api.Client) error {
+	ctx := context.Background()
+
+	ids, err := setupIdentity(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+	idsNS, err := setupIdentity(ctx, clone)
+	if err != nil {
+		return err
+	}
+
+	// the group policy of the root namespace does not reach the namespace, nor the reverse;
+	// the policy is read-only, so the denied read is what proves it, the denied write is extra
+	path := "idkv"
+	for _, c := range []struct {
+		client *api.Client
+		token  string
+	}{
+		{clone, ids["aliceToken"]},
+		{client, idsNS["aliceToken"]},
+	} {
+		err = checkKV2ReadDenied(ctx, c.client, c.token, path, "mysecret")
+		if err != nil {
+			return err
+		}
+		err = checkKV2Access(ctx, c.client, c.token, path, nil, []string{"mysecret"})
+		if err != nil {
+			return err
+		}
+	}
+
+	// a group of the namespace cannot have an entity of the root namespace as member
+	logicalNS := clone.Logical()
+	_, err = logicalNS.WriteWithContext(ctx, "identity/group/name/readers", map[string]any{
+		"member_entity_ids": []string{idsNS["alice"], ids["bob"]},
+	})
+	if err == nil {
+		secret, err := logicalNS.ReadWithContext(ctx, "identity/group/name/readers")
+		if err != nil {
+			return err
+		}
+		if secret != nil && secret.Data != nil && fmt.Sprint(secret.Data["member_entity_ids"]) != fmt.Sprint([]any{idsNS["alice"]}) {
+			return fmt.Errorf("group in namespace has members %v", secret.Data["member_entity_ids"])
+		}
+	}
+
+	// entities cannot be merged across namespaces
+	_, err = logicalNS.WriteWithContext(ctx, "identity/entity/merge", map[string]any{
+		"from_entity_ids": []string{ids["bob"]},
+		"to_entity_id":    idsNS["alice"],
+	})
+	if err == nil {
+		return fmt.Errorf("entity of the root namespace merged in the namespace")
+	}
+	_, err = client.Logical().WriteWithContext(ctx, "identity/entity/merge", map[string]any{
+		"from_entity_ids": []string{idsNS["bob"]},
+		"to_entity_id":    ids["alice"],
+	})
+	if err == nil {
+		return fmt.Errorf("entity of the namespace merged in the root namespace")
+	}
+	secret, err := client.Logical().ReadWithContext(ctx, "identity/entity/id/"+ids["bob"])
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["name"] != "bob" {
+		return fmt.Errorf("bob after merge: %+v", secret)
+	}
+
+	err = dropIdentity(ctx, client)
+	if err != nil {
+		return err
+	}
+	client.SetNamespace(os.Getenv("VAULT_NAMESPACE"))
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckIdentityParentGroup checks what an entity of the namespace pname/cname can reach once it is a member
+// of a group in the parent namespace pname. The policy of the group grants reading pkv in pname, and ckv in
+// pname/cname by a path relative to pname. If the server refuses the membership, the entity must reach nothing.
+// It returns the membership and what the entity reaches as a table, which is the error on unexpected outcomes.
+func CheckIdentityParentGroup(client *api.Client) (string, error) {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return "", err
+	}
+	subNS := "cname"
+	clone2, err := cloneClient(ctx, clone, subNS)
+	if err != nil {
+		return "", err
+	}
+
+	clients := map[string]*api.Client{"": client, rootNS: clone, rootNS + "/" + subNS: clone2}
+	mounts := map[string][]string{"": {"pkv"}, rootNS: {"pkv"}, rootNS + "/" + subNS: {"pkv", "ckv"}}
+	for ns, paths := range mounts {
+		for _, path := range paths {
+			err = createKV2Secret(ctx, clients[ns], path, "mysecret", "myadmin", "123456")
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// alice lives in the child namespace
+	err = clone2.Sys().EnableAuthWithOptionsWithContext(ctx, "userpass", &api.EnableAuthOptions{
+		Type: "userpass",
+	})
+	if err != nil {
+		return "", err
+	}
+	time.Sleep(sleeping)
+	alice, err := createEntity(ctx, clone2, "alice", nil)
+	if err != nil {
+		return "", err
+	}
+	accessor, err := getAuthAccessor(ctx, clone2, "userpass")
+	if err != nil {
+		return "", err
+	}
+	_, err = createEntityAlias(ctx, clone2, alice, "alice", accessor)
+	if err != nil {
+		return "", err
+	}
+	err = putUserpassUser(ctx, clone2, "userpass", "alice", "pass", "default")
+	if err != nil {
+		return "", err
+	}
+	token, err := loginUserpass(ctx, clone2, "userpass", "alice", "pass")
+	if err != nil {
+		return "", err
+	}
+
+	// the group lives in the parent namespace
+	err = clone.Sys().PutPolicyWithContext(ctx, "parentread", `
+	# Allow reading pkv in the parent namespace
+	path "pkv/data/*" {
+		capabilities = ["read"]
+	}
+	# Allow reading ckv in the child namespace
+	path "`+subNS+`/ckv/data/*" {
+		capabilities = ["read"]
+	}
+	`)
+	if err != nil {
+		return "", err
+	}
+
+	// the membership is either accepted, refused with an invalid member error, or silently dropped
+	member := false
+	groupID, err := createGroup(ctx, clone, "parentgroup", []string{"parentread"}, []string{alice})
+	if err == nil {
+		secret, err := clone.Logical().ReadWithContext(ctx, "identity/group/id/"+groupID)
+		if err != nil {
+			return "", err
+		}
+		member = secret != nil && secret.Data != nil && fmt.Sprint(secret.Data["member_entity_ids"]) == fmt.Sprint([]any{alice})
+	} else if !isInvalidMember(err) {
+		return "", fmt.Errorf("group in %s with alice of %s/%s: %w", rootNS, rootNS, subNS, err)
+	}
+	expected := map[string]bool{}
+	if member {
+		expected[rootNS+"/pkv"] = true
+		expected[rootNS+"/"+subNS+"/ckv"] = true
+	}
+
+	// every resource alice can reach, with unexpected outcomes flagged
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "MEMBER %t\tNAMESPACE\tMOUNT\tEXPECTED\tGOT\n", member)
+	failures := 0
+	namespaces := slices.Sorted(maps.Keys(mounts))
+	for _, ns := range namespaces {
+		tokenClient, err := newTokenClient(clients[ns], token)
+		if err != nil {
+			return "", err
+		}
+		for _, path := range mounts[ns] {
+			_, err = tokenClient.KVv2(path).Get(ctx, "mysecret")
+			if err != nil && !strings.Contains(err.Error(), "permission denied") {
+				return "", err
+			}
+			resource := path
+			if ns != "" {
+				resource = ns + "/" + path
+			}
+			got := err == nil
+			flag := ""
+			if got != expected[resource] {
+				failures++
+				flag = "UNEXPECTED"
+			}
+			fmt.Fprintf(w, "%s\t%q\t%s\t%t\t%t\n", flag, ns, path, expected[resource], got)
+		}
+	}
+	w.Flush()
+	if failures > 0 {
+		return "", fmt.Errorf("%d unexpected outcomes for a member of a parent group:\n%s", failures, table.String())
+	}
+
+	// clean up
+	err = client.Sys().UnmountWithContext(ctx, "pkv")
+	if err != nil {
+		return "", err
+	}
+	_, err = clone.Logical().DeleteWithContext(ctx, "sys/namespaces/"+subNS)
+	if err != nil {
+		return "", err
+	}
+	time.Sleep(sleeping)
+	client.SetNamespace(os.Getenv("VAULT_NAMESPACE"))
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return "", err
+	}
+	return table.String(), nil
+}
+
+// setupIdentity creates in the namespace of client a KV2 secret readable by the group readers, the entity alice
+// with a userpass alias and member of readers, the entity bob with an AppRole alias, and an external group.
+// It checks the access of alice and bob, merges the entity carol into alice, and returns the ids and tokens.
+func setupIdentity(ctx context.Context, client *api.Client) (map[string]string, error) {
+	sys := client.Sys()
+	logical := client.Logical()
+
+	path := "idkv"
+	err := createKV2Secret(ctx, client, path, "mysecret", "myadmin", "123456")
+	if err != nil {
+		return nil, err
+	}
+	err = sys.PutPolicyWithContext(ctx, "readers", getKV2Read(path))
+	if err != nil {
+		return nil, err
+	}
+	for _, authType := range []string{"userpass", "approle"} {
+		err = sys.EnableAuthWithOptionsWithContext(ctx, authType, &api.EnableAuthOptions{
+			Type: authType,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	time.Sleep(sleeping)
+
+	ids := make(map[string]string)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		ids[name], err = createEntity(ctx, client, name, map[string]string{"team": "red"})
+		if err != nil {
+			return nil, err
+		}
+	}
+	ids["readers"], err = createGroup(ctx, client, "readers", []string{"readers"}, []string{ids["alice"]})
+	if err != nil {
+		return nil, err
+	}
+
+	// alice logs in with userpass, and reads as a member of readers
+	accessor, err := getAuthAccessor(ctx, client, "userpass")
+	if err != nil {
+		return nil, err
+	}
+	_, err = createEntityAlias(ctx, client, ids["alice"], "alice", accessor)
+	if err != nil {
+		return nil, err
+	}
+	err = putUserpassUser(ctx, client, "userpass", "alice", "pass", "default")
+	if err != nil {
+		return nil, err
+	}
+	ids["aliceToken"], err = loginUserpass(ctx, client, "userpass", "alice", "pass")
+	if err != nil {
+		return nil, err
+	}
+	tokenClient, err := newTokenClient(client, ids["aliceToken"])
+	if err != nil {
+		return nil, err
+	}
+	err = canReadNotWriteTitle(ctx, tokenClient, path, "mysecret")
+	if err != nil {
+		return nil, err
+	}
+	secret, err := tokenClient.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["entity_id"] != ids["alice"] {
+		return nil, fmt.Errorf("alice token: %+v", secret)
+	}
+
+	// bob logs in with AppRole, and cannot read
+	accessor, err = getAuthAccessor(ctx, client, "approle")
+	if err != nil {
+		return nil, err
+	}
+	roleID, secretID, err := putApproleRole(ctx, client, "approle", "bob", nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = createEntityAlias(ctx, client, ids["bob"], roleID, accessor)
+	if err != nil {
+		return nil, err
+	}
+	ids["bobToken"], err = loginApprole(ctx, client, "approle", roleID, secretID)
+	if err != nil {
+		return nil, err
+	}
+	tokenClient, err = newTokenClient(client, ids["bobToken"])
+	if err != nil {
+		return nil, err
+	}
+	_, err = tokenClient.KVv2(path).Get(ctx, "mysecret")
+	if err == nil {
+		return nil, fmt.Errorf("bob read the secret of readers")
+	}
+
+	// an external group gets its members from the auth method, not by hand
+	secret, err = logical.WriteWithContext(ctx, "identity/group", map[string]any{
+		"name":     "external",
+		"type":     "external",
+		"policies": []string{"readers"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["id"] == nil {
+		return nil, fmt.Errorf("external group: %+v", secret)
+	}
+	ids["external"] = secret.Data["id"].(string)
+	_, err = logical.WriteWithContext(ctx, "identity/group-alias", map[string]any{
+		"name":           "external",
+		"mount_accessor": accessor,
+		"canonical_id":   ids["external"],
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = logical.WriteWithContext(ctx, "identity/group/id/"+ids["external"], map[string]any{
+		"member_entity_ids": []string{ids["bob"]},
+	})
+	if err == nil {
+		return nil, fmt.Errorf("member added by hand to an external group")
+	}
+
+	// carol is merged into alice
+	_, err = logical.WriteWithContext(ctx, "identity/entity/merge", map[string]any{
+		"from_entity_ids": []string{ids["carol"]},
+		"to_entity_id":    ids["alice"],
+	})
+	if err != nil {
+		return nil, err
+	}
+	secret, err = logical.ReadWithContext(ctx, "identity/entity/id/"+ids["carol"])
+	if err != nil {
+		return nil, err
+	}
+	if secret != nil {
+		return nil, fmt.Errorf("carol after merge: %+v", secret)
+	}
+
+	return ids, nil
+}
+
+// dropIdentity removes what setupIdentity has created in the namespace of client.
+func dropIdentity(ctx context.Context, client *api.Client) error {
+	sys := client.Sys()
+	logical := client.Logical()
+
+	for _, p := range []string{"identity/group/name/readers", "identity/group/name/external", "identity/entity/name/alice", "identity/entity/name/bob"} {
+		_, err := logical.DeleteWithContext(ctx, p)
+		if err != nil {
+			return err
+		}
+	}
+	for _, authType := range []string{"userpass", "approle"} {
+		err := sys.DisableAuthWithContext(ctx, authType)
+		if err != nil {
+			return err
+		}
+	}
+	err := sys.DeletePolicyWithContext(ctx, "readers")
+	if err != nil {
+		return err
+	}
+	return sys.UnmountWithContext(ctx, "idkv")
+}
+
+// getAuthAccessor returns the accessor of the auth method mounted at path in the namespace of client.
+func getAuthAccessor(ctx context.Context, client *api.Client, path string) (string, error) {
+	mountsRspn, err := client.Sys().ListAuthWithContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	mount, ok := mountsRspn[path+"/"]
+	if !ok || mount.Accessor == "" {
+		return "", fmt.Errorf("auth %s not found in %+v", path, mountsRspn)
+	}
+	return mount.Accessor, nil
+}
+
+// createEntity creates an entity with the given metadata and returns its id.
+func createEntity(ctx context.Context, client *api.Client, name string, metadata map[string]string, policies ...string) (string, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, "identity/entity", map[string]any{
+		"name":     name,
+		"metadata": metadata,
+		"policies": policies,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["id"] == nil {
+		return "", fmt.Errorf("entity %s: %+v", name, secret)
+	}
+	return secret.Data["id"].(string), nil
+}
+
+// createEntityAlias binds the entity to the login name of the auth method with the given accessor,
+// and returns the id of the alias.
+func createEntityAlias(ctx context.Context, client *api.Client, entityID, name, accessor string) (string, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, "identity/entity-alias", map[string]any{
+		"name":           name,
+		"canonical_id":   entityID,
+		"mount_accessor": accessor,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["id"] == nil {
+		return "", fmt.Errorf("entity alias %s: %+v", name, secret)
+	}
+	return secret.Data["id"].(string), nil
+}
+
+// createGroup creates an internal group with the given policies and member entities, and returns its id.
+func createGroup(ctx context.Context, client *api.Client, name string, policies, memberEntityIDs []string) (string, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, "identity/group", map[string]any{
+		"name":              name,
+		"type":              "internal",
+		"policies":          policies,
+		"member_entity_ids": memberEntityIDs,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["id"] == nil {
+		return "", fmt.Errorf("group %s: %+v", name, secret)
+	}
+	return secret.Data["id"].(string), nil
+}
+
+// invalidMember matches the error refusing an entity of another namespace as a group member.
+var invalidMember = regexp.MustCompile(`(?i)invalid (member )?entity|entity .*(not found|does not exist)|different namespace|same namespace`)
+
+// isInvalidMember tells whether err is the refusal of a group member, rather than a mistake or a server fault.
+func isInvalidMember(err error) bool {
+	var rErr *api.ResponseError
+	return errors.As(err, &rErr) && rErr.StatusCode == http.StatusBadRequest && slices.ContainsFunc(rErr.Errors, invalidMember.MatchString)
+}
+
+// checkKV2ReadDenied checks that the token is denied reading the KV2 secret name at path in the namespace of client.
+func checkKV2ReadDenied(ctx context.Context, client *api.Client, token, path, name string) error {
+	tokenClient, err := newTokenClient(client, token)
+	if err != nil {
+		return err
+	}
+	kvSecret, err := tokenClient.KVv2(path).Get(ctx, name)
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		return fmt.Errorf("read %s in %s should be denied: %v, %+v", name, tokenClient.Namespace(), err, kvSecret)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestIdentityRoot tests the identity entities, aliases and groups at the root namespace.
+func TestIdentityRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckIdentityRoot(client)
+	if err != nil {
+		t.Fatalf("IdentityRoot failed: %v", err)
+	}
+}
+
+// TestIdentityNamespace tests the identity entities, aliases and groups in a specific namespace.
+func TestIdentityNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckIdentityNamespace(client)
+	if err != nil {
+		t.Fatalf("IdentityNamespace failed: %v", err)
+	}
+}
+
+// TestIdentityMix tests that identity groups and entity merges stay within their namespace.
+func TestIdentityMix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckIdentityMix(client)
+	if err != nil {
+		t.Fatalf("IdentityMix failed: %v", err)
+	}
+}
+
+// TestIdentityParentGroup tests the access granted to a child namespace entity by a group in the parent namespace.
+func TestIdentityParentGroup(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	reach, err := CheckIdentityParentGroup(client)
+	if err != nil {
+		t.Fatalf("IdentityParentGroup failed: %v", err)
+	}
+	t.Logf("reach of a member of a parent group:\n%s", reach)
+}
@@ -0,0 +1,335 @@
+package vaultcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// leasedToken is a token of the token role leased, and its lease.
+type leasedToken struct {
+	leaseID  string
+	accessor string
+	client   *api.Client
+}
+
+// CheckLeases checks sys/leases on the token leases of the namespace pname/cname: lookup, list by prefix,
+// revoke, revoke-prefix and revoke-force work from the owning namespace, and from the parent namespace pname
+// through the cname/ path prefix, but not from the sibling namespace pname/dname. Token leases are renewed
+// through the token store, not through sys/leases/renew.
+func CheckLeases(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+	subNS := "cname"
+	clone2, err := cloneClient(ctx, clone, subNS)
+	if err != nil {
+		return err
+	}
+	siblingNS := "dname"
+	sibling, err := cloneClient(ctx, clone, siblingNS)
+	if err != nil {
+		return err
+	}
+
+	// tokens of the role have their own lease prefix, apart from the tokens of the lease managers
+	role := "leased"
+	_, err = clone2.Logical().WriteWithContext(ctx, "auth/token/roles/"+role, map[string]any{
+		"allowed_policies": "default",
+		"renewable":        true,
+	})
+	if err != nil {
+		return err
+	}
+	prefix := "auth/token/create/" + role
+
+	// a lease manager in each namespace; the parent one reaches the leases of cname by its path prefix
+	rootToken := client.Token()
+	name := "leases"
+	type leaseManager struct {
+		client *api.Client
+		prefix string
+	}
+	managers := make(map[string]leaseManager)
+	for _, m := range []struct {
+		rel    string
+		client *api.Client
+		prefix string
+	}{
+		{"same", clone2, ""},
+		{"parent", clone, subNS + "/"},
+		{"sibling", sibling, ""},
+	} {
+		err = m.client.Sys().PutPolicyWithContext(ctx, name, getLeasesRule(m.prefix))
+		if err != nil {
+			return err
+		}
+		tokenClient, err := createChildToken(ctx, m.client, rootToken, name)
+		if err != nil {
+			return err
+		}
+		managers[m.rel] = leaseManager{tokenClient, m.prefix}
+	}
+	owner := managers["same"]
+
+	leases := make([]*leasedToken, 6)
+	for i := range leases {
+		leases[i], err = createLeasedToken(ctx, clone2, rootToken, role)
+		if err != nil {
+			return err
+		}
+	}
+
+	// lookup, renew, list and revoke a lease each, from the owning and the parent namespace
+	for i, rel := range []string{"same", "parent"} {
+		m := managers[rel]
+		lease := leases[i]
+		secret, err := m.client.Logical().WriteWithContext(ctx, m.prefix+"sys/leases/lookup", map[string]any{
+			"lease_id": lease.leaseID,
+		})
+		if err != nil {
+			return fmt.Errorf("lookup from %s: %w", m.client.Namespace(), err)
+		}
+		if secret == nil || secret.Data == nil || secret.Data["id"] != lease.leaseID || secret.Data["renewable"] != true {
+			return fmt.Errorf("lookup from %s: %+v", m.client.Namespace(), secret)
+		}
+
+		// token leases are renewed by the token store only
+		secret, err = m.client.Logical().WriteWithContext(ctx, m.prefix+"sys/leases/renew", map[string]any{
+			"lease_id":  lease.leaseID,
+			"increment": 7200,
+		})
+		if err == nil {
+			return fmt.Errorf("token lease renewed through sys/leases from %s: %+v", m.client.Namespace(), secret)
+		}
+		_, err = m.client.Logical().WriteWithContext(ctx, m.prefix+"auth/token/renew-accessor", map[string]any{
+			"accessor":  lease.accessor,
+			"increment": 7200,
+		})
+		if err != nil {
+			return fmt.Errorf("renew from %s: %w", m.client.Namespace(), err)
+		}
+		secret, err = m.client.Logical().WriteWithContext(ctx, m.prefix+"sys/leases/lookup", map[string]any{
+			"lease_id": lease.leaseID,
+		})
+		if err != nil {
+			return err
+		}
+		if secret == nil || secret.Data == nil {
+			return fmt.Errorf("lookup after renew from %s: %+v", m.client.Namespace(), secret)
+		}
+		if ttl, err := strconv.Atoi(fmt.Sprint(secret.Data["ttl"])); err != nil || ttl <= 3600 {
+			return fmt.Errorf("TTL after renew from %s: %v, %v", m.client.Namespace(), secret.Data["ttl"], err)
+		}
+
+		keys, err := listLeases(ctx, m.client, m.prefix, prefix)
+		if err != nil {
+			return fmt.Errorf("list from %s: %w", m.client.Namespace(), err)
+		}
+		if len(keys) != len(leases)-i {
+			return fmt.Errorf("list from %s: %v", m.client.Namespace(), keys)
+		}
+
+		_, err = m.client.Logical().WriteWithContext(ctx, m.prefix+"sys/leases/revoke", map[string]any{
+			"lease_id": lease.leaseID,
+		})
+		if err != nil {
+			return fmt.Errorf("revoke from %s: %w", m.client.Namespace(), err)
+		}
+		err = checkLeasedTokens(ctx, leases[i:], leases[i+1:]...)
+		if err != nil {
+			return fmt.Errorf("revoke from %s: %w", m.client.Namespace(), err)
+		}
+	}
+
+	// the sibling namespace neither sees nor renews the leases, and its revocations do not reach them,
+	// whether the server refuses them or ignores them
+	m := managers["sibling"]
+	leaseID := leases[2].leaseID
+	for _, op := range []string{"lookup", "renew"} {
+		secret, err := m.client.Logical().WriteWithContext(ctx, "sys/leases/"+op, map[string]any{
+			"lease_id": leaseID,
+		})
+		if err == nil {
+			return fmt.Errorf("%s of lease %s from %s: %+v", op, leaseID, m.client.Namespace(), secret)
+		}
+	}
+	keys, err := listLeases(ctx, m.client, "", prefix)
+	if err == nil && len(keys) > 0 {
+		return fmt.Errorf("leases listed from %s: %v", m.client.Namespace(), keys)
+	}
+	// a refusal by the server is collected, to be reported with any lease the revocations reached
+	var refusals []error
+	for _, op := range []string{"revoke", "revoke-prefix/" + prefix} {
+		var data map[string]any
+		if op == "revoke" {
+			data = map[string]any{"lease_id": leaseID}
+		}
+		_, err = m.client.Logical().WriteWithContext(ctx, "sys/leases/"+op, data)
+		if err != nil {
+			if _, ok := err.(*api.ResponseError); !ok {
+				return fmt.Errorf("%s from %s: %w", op, m.client.Namespace(), err)
+			}
+			refusals = append(refusals, fmt.Errorf("%s refused: %w", op, err))
+		}
+	}
+	keys, err = listLeases(ctx, owner.client, "", prefix)
+	if err != nil {
+		return err
+	}
+	if len(keys) != len(leases)-2 {
+		return fmt.Errorf("leases after the sibling revoked them: %v, refusals: %v", keys, refusals)
+	}
+	err = checkLeasedTokens(ctx, leases[2:], leases[2:]...)
+	if err != nil {
+		return fmt.Errorf("revoke from %s: %w", m.client.Namespace(), errors.Join(append(refusals, err)...))
+	}
+
+	// revoke-prefix from the owning namespace, then revoke-force from the parent namespace
+	for _, c := range []struct {
+		rel string
+		op  string
+	}{
+		{"same", "revoke-prefix"},
+		{"parent", "revoke-force"},
+	} {
+		m := managers[c.rel]
+		for range 2 {
+			lease, err := createLeasedToken(ctx, clone2, rootToken, role)
+			if err != nil {
+				return err
+			}
+			leases = append(leases, lease)
+		}
+		_, err = m.client.Logical().WriteWithContext(ctx, m.prefix+"sys/leases/"+c.op+"/"+prefix, nil)
+		if err != nil {
+			return fmt.Errorf("%s from %s: %w", c.op, m.client.Namespace(), err)
+		}
+		time.Sleep(sleeping)
+		keys, err = listLeases(ctx, owner.client, "", prefix)
+		if err != nil {
+			return err
+		}
+		if len(keys) != 0 {
+			return fmt.Errorf("leases after %s from %s: %v", c.op, m.client.Namespace(), keys)
+		}
+		err = checkLeasedTokens(ctx, leases)
+		if err != nil {
+			return fmt.Errorf("%s from %s: %w", c.op, m.client.Namespace(), err)
+		}
+	}
+
+	// clean up
+	for _, ns := range []string{subNS, siblingNS} {
+		_, err = clone.Logical().DeleteWithContext(ctx, "sys/namespaces/"+ns)
+		if err != nil {
+			return err
+		}
+	}
+	time.Sleep(sleeping)
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// listLeases lists the leases under prefix through sys/leases/lookup, with nsPrefix prepended
+// to reach a child namespace. No lease at all is an empty list.
+func listLeases(ctx context.Context, client *api.Client, nsPrefix, prefix string) ([]any, error) {
+	secret, err := client.Logical().ListWithContext(ctx, nsPrefix+"sys/leases/lookup/"+prefix)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["keys"] == nil {
+		return nil, nil
+	}
+	return secret.Data["keys"].([]any), nil
+}
+
+// createLeasedToken creates a token of the token role in the namespace of client, and finds its lease
+// as the one new lease under the prefix of the role.
+func createLeasedToken(ctx context.Context, client *api.Client, rootToken, role string) (*leasedToken, error) {
+	client.SetToken(rootToken)
+	prefix := "auth/token/create/" + role
+
+	before, err := listLeases(ctx, client, "", prefix)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := client.Auth().Token().CreateWithRoleWithContext(ctx, &api.TokenCreateRequest{
+		Policies: []string{"default"},
+		TTL:      "1h",
+	}, role)
+	if err != nil {
+		return nil, err
+	}
+	if secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("Auth data: %+v", secret.Auth)
+	}
+	after, err := listLeases(ctx, client, "", prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var added []any
+	for _, key := range after {
+		if !slices.Contains(before, key) {
+			added = append(added, key)
+		}
+	}
+	if len(added) != 1 {
+		return nil, fmt.Errorf("new leases under %s: %v", prefix, added)
+	}
+	tokenClient, err := newTokenClient(client, secret.Auth.ClientToken)
+	if err != nil {
+		return nil, err
+	}
+	return &leasedToken{
+		leaseID:  prefix + "/" + added[0].(string),
+		accessor: secret.Auth.Accessor,
+		client:   tokenClient,
+	}, nil
+}
+
+// checkLeasedTokens checks that, of the leased tokens, exactly those in valid are still valid.
+func checkLeasedTokens(ctx context.Context, leases []*leasedToken, valid ...*leasedToken) error {
+	for _, lease := range leases {
+		ok, err := isTokenValid(ctx, lease.client)
+		if err != nil {
+			return err
+		}
+		if ok != slices.Contains(valid, lease) {
+			return fmt.Errorf("token of lease %s valid: %t", lease.leaseID, ok)
+		}
+	}
+	return nil
+}
+
+// getLeasesRule returns the ACL policy for managing the leases and renewing tokens by accessor,
+// with nsPrefix prepended to reach a child namespace.
+func getLeasesRule(nsPrefix string) string {
+	return `
+	path "` + nsPrefix + `sys/leases/*" {
+		capabilities = ["create", "read", "update", "list", "sudo"]
+	}
+	path "` + nsPrefix + `sys/leases/revoke-prefix/*" {
+		capabilities = ["update", "sudo"]
+	}
+	path "` + nsPrefix + `sys/leases/revoke-force/*" {
+		capabilities = ["update", "sudo"]
+	}
+	path "` + nsPrefix + `auth/token/renew-accessor" {
+		capabilities = ["update"]
+	}
+	`
+}
@@ -0,0 +1,18 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestLeases tests lease management from the owning, parent and sibling namespaces.
+func TestLeases(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckLeases(client)
+	if err != nil {
+		t.Fatalf("Leases failed: %v", err)
+	}
+}
@@ -0,0 +1,232 @@
+package vaultcheck
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// passwordPolicy is a password policy whose generated passwords can be validated locally.
+type passwordPolicy struct {
+	length int
+	rules  []passwordRule
+}
+
+// passwordRule is a charset rule of a password policy.
+type passwordRule struct {
+	charset  string
+	minChars int
+}
+
+// hcl renders the password policy as expected by sys/policies/password.
+func (p *passwordPolicy) hcl() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "length = %d\n", p.length)
+	for _, r := range p.rules {
+		fmt.Fprintf(&b, "rule \"charset\" {\n\tcharset = %q\n\tmin-chars = %d\n}\n", r.charset, r.minChars)
+	}
+	return b.String()
+}
+
+// validate checks the length of the password, that it uses only the charsets of the rules,
+// and that it has at least the minimum number of characters of each charset.
+func (p *passwordPolicy) validate(password string) error {
+	if n := utf8.RuneCountInString(password); n != p.length {
+		return fmt.Errorf("password %q has length %d, not %d", password, n, p.length)
+	}
+	counts := make([]int, len(p.rules))
+	for _, c := range password {
+		found := false
+		for i, r := range p.rules {
+			if strings.ContainsRune(r.charset, c) {
+				counts[i]++
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("password %q has %q out of the charsets", password, c)
+		}
+	}
+	for i, r := range p.rules {
+		if counts[i] < r.minChars {
+			return fmt.Errorf("password %q has %d of %q, less than %d", password, counts[i], r.charset, r.minChars)
+		}
+	}
+	return nil
+}
+
+// CheckPasswordPolicyRoot checks that passwords generated by a password policy follow its rules in the root namespace.
+func CheckPasswordPolicyRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	return checkPasswordPolicy(ctx, client, "mypolicy", getMixedPasswordPolicy())
+}
+
+// CheckPasswordPolicyNamespace checks that passwords generated by a password policy follow its rules in the namespace.
+func CheckPasswordPolicyNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	err = checkPasswordPolicy(ctx, clone, "mypolicy", getMixedPasswordPolicy())
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckPasswordPolicyMix checks that identically named password policies in the sibling namespaces
+// pname/cname and pname/dname are distinct, and invisible from their parent pname.
+func CheckPasswordPolicyMix(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+	policies := map[string]*passwordPolicy{
+		"cname": {12, []passwordRule{{"0123456789", 12}}},
+		"dname": {30, []passwordRule{{"abcdefghijklmnopqrstuvwxyz", 30}}},
+	}
+	clients := make(map[string]*api.Client)
+	name := "mypolicy"
+	for ns, p := range policies {
+		clients[ns], err = cloneClient(ctx, clone, ns)
+		if err != nil {
+			return err
+		}
+		err = putPasswordPolicy(ctx, clients[ns], name, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	for ns, c := range clients {
+		password, err := generatePassword(ctx, c, name)
+		if err != nil {
+			return err
+		}
+		for other, p := range policies {
+			err = p.validate(password)
+			if other == ns && err != nil {
+				return fmt.Errorf("namespace %s: %w", ns, err)
+			}
+			if other != ns && err == nil {
+				return fmt.Errorf("password %q of namespace %s follows the policy of %s", password, ns, other)
+			}
+		}
+	}
+
+	// the parent has no such policy
+	password, err := generatePassword(ctx, clone, name)
+	if err == nil {
+		return fmt.Errorf("password %q generated in %s", password, clone.Namespace())
+	}
+
+	// clean up
+	for ns := range clients {
+		_, err = clone.Logical().DeleteWithContext(ctx, "sys/namespaces/"+ns)
+		if err != nil {
+			return err
+		}
+	}
+	time.Sleep(sleeping)
+	client.SetNamespace(os.Getenv("VAULT_NAMESPACE"))
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkPasswordPolicy writes the password policy in the namespace of client, reads it back,
+// validates a few generated passwords, and deletes the policy.
+func checkPasswordPolicy(ctx context.Context, client *api.Client, name string, p *passwordPolicy) error {
+	logical := client.Logical()
+
+	err := putPasswordPolicy(ctx, client, name, p)
+	if err != nil {
+		return err
+	}
+	secret, err := logical.ReadWithContext(ctx, "sys/policies/password/"+name)
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["policy"] != p.hcl() {
+		return fmt.Errorf("password policy %s: %+v", name, secret)
+	}
+
+	seen := make(map[string]bool)
+	for range 10 {
+		password, err := generatePassword(ctx, client, name)
+		if err != nil {
+			return err
+		}
+		err = p.validate(password)
+		if err != nil {
+			return err
+		}
+		if seen[password] {
+			return fmt.Errorf("password %q generated twice", password)
+		}
+		seen[password] = true
+	}
+
+	_, err = logical.DeleteWithContext(ctx, "sys/policies/password/"+name)
+	if err != nil {
+		return err
+	}
+	_, err = generatePassword(ctx, client, name)
+	if err == nil {
+		return fmt.Errorf("password generated from deleted policy %s", name)
+	}
+	return nil
+}
+
+// putPasswordPolicy writes the password policy in the namespace of client.
+func putPasswordPolicy(ctx context.Context, client *api.Client, name string, p *passwordPolicy) error {
+	_, err := client.Logical().WriteWithContext(ctx, "sys/policies/password/"+name, map[string]any{
+		"policy": p.hcl(),
+	})
+	return err
+}
+
+// generatePassword generates a password from the password policy in the namespace of client.
+func generatePassword(ctx context.Context, client *api.Client, name string) (string, error) {
+	secret, err := client.Logical().ReadWithContext(ctx, "sys/policies/password/"+name+"/generate")
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["password"] == nil {
+		return "", fmt.Errorf("no password from %s: %+v", name, secret)
+	}
+	return secret.Data["password"].(string), nil
+}
+
+// getMixedPasswordPolicy returns a password policy requiring lower and upper case letters, digits and symbols.
+func getMixedPasswordPolicy() *passwordPolicy {
+	return &passwordPolicy{
+		length: 20,
+		rules: []passwordRule{
+			{"abcdefghijklmnopqrstuvwxyz", 1},
+			{"ABCDEFGHIJKLMNOPQRSTUVWXYZ", 1},
+			{"0123456789", 1},
+			{"!@#$%^&*", 1},
+		},
+	}
+}
@@ -0,0 +1,44 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestPasswordPolicyRoot tests the password policies at the root namespace.
+func TestPasswordPolicyRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPasswordPolicyRoot(client)
+	if err != nil {
+		t.Fatalf("PasswordPolicyRoot failed: %v", err)
+	}
+}
+
+// TestPasswordPolicyNamespace tests the password policies in a specific namespace.
+func TestPasswordPolicyNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPasswordPolicyNamespace(client)
+	if err != nil {
+		t.Fatalf("PasswordPolicyNamespace failed: %v", err)
+	}
+}
+
+// TestPasswordPolicyMix tests that identically named password policies in sibling namespaces are distinct.
+func TestPasswordPolicyMix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPasswordPolicyMix(client)
+	if err != nil {
+		t.Fatalf("PasswordPolicyMix failed: %v", err)
+	}
+}
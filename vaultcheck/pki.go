@@ -0,0 +1,298 @@
+package vaultcheck
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// CheckPKIRoot checks a certificate authority, its role, issuance, revocation and CRL in the root namespace.
+func CheckPKIRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	path := "pki"
+	_, err := checkPKI(ctx, client, path, "Root Namespace CA")
+	if err != nil {
+		return err
+	}
+	return client.Sys().UnmountWithContext(ctx, path)
+}
+
+// CheckPKINamespace checks a certificate authority, its role, issuance, revocation and CRL in the namespace.
+func CheckPKINamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	path := "pki"
+	_, err = checkPKI(ctx, clone, path, "Pname CA")
+	if err != nil {
+		return err
+	}
+	err = clone.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckPKIMix checks that the certificate authorities at pki in the root namespace and in the namespace
+// have their own issuers and CRLs: a certificate is verified by its own CA only, and cannot be looked up
+// or revoked from the other namespace.
+func CheckPKIMix(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	path := "pki"
+	rootCA, err := checkPKI(ctx, client, path, "Root Namespace CA")
+	if err != nil {
+		return err
+	}
+	nsCA, err := checkPKI(ctx, clone, path, "Pname CA")
+	if err != nil {
+		return err
+	}
+
+	rootCert, _, err := issuePKICert(ctx, client, path, "www.example.com")
+	if err != nil {
+		return err
+	}
+	nsCert, nsSerial, err := issuePKICert(ctx, clone, path, "www.example.com")
+	if err != nil {
+		return err
+	}
+	if err = verifyPKICert(nsCA, rootCert, "www.example.com"); err == nil {
+		return fmt.Errorf("certificate of the root namespace verified by the CA of the namespace")
+	}
+	if err = verifyPKICert(rootCA, nsCert, "www.example.com"); err == nil {
+		return fmt.Errorf("certificate of the namespace verified by the CA of the root namespace")
+	}
+
+	rootIssuers, err := listPKIIssuers(ctx, client, path)
+	if err != nil {
+		return err
+	}
+	nsIssuers, err := listPKIIssuers(ctx, clone, path)
+	if err != nil {
+		return err
+	}
+	if len(rootIssuers) != 1 || len(nsIssuers) != 1 || rootIssuers[0] == nsIssuers[0] {
+		return fmt.Errorf("issuers: %v in the root namespace, %v in the namespace", rootIssuers, nsIssuers)
+	}
+
+	// the certificate of the namespace is unknown to the root namespace
+	secret, err := client.Logical().ReadWithContext(ctx, path+"/cert/"+nsSerial)
+	if err != nil {
+		return err
+	}
+	if secret != nil {
+		return fmt.Errorf("certificate %s of the namespace read in the root namespace: %+v", nsSerial, secret.Data)
+	}
+	_, err = client.Logical().WriteWithContext(ctx, path+"/revoke", map[string]any{
+		"serial_number": nsSerial,
+	})
+	if err == nil {
+		return fmt.Errorf("certificate %s of the namespace revoked in the root namespace", nsSerial)
+	}
+	crl, err := readPKICRL(ctx, clone, path)
+	if err != nil {
+		return err
+	}
+	if isPKIRevoked(crl, nsCert) {
+		return fmt.Errorf("certificate %s of the namespace in its CRL", nsSerial)
+	}
+
+	// clean up
+	err = clone.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	err = client.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkPKI mounts pki at path in the namespace of client, generates an internal root CA with commonName
+// and a role web for example.com, issues and verifies certificates, and revokes one of them.
+// It returns the CA certificate.
+func checkPKI(ctx context.Context, client *api.Client, path, commonName string) (*x509.Certificate, error) {
+	logical := client.Logical()
+
+	err := client.Sys().MountWithContext(ctx, path, &api.MountInput{
+		Type: "pki",
+		Config: api.MountConfigInput{
+			MaxLeaseTTL: "87600h",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(sleeping)
+
+	secret, err := logical.WriteWithContext(ctx, path+"/root/generate/internal", map[string]any{
+		"common_name": commonName,
+		"ttl":         "8760h",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["certificate"] == nil {
+		return nil, fmt.Errorf("root CA %s: %+v", commonName, secret)
+	}
+	ca, err := parsePKICert(secret.Data["certificate"].(string))
+	if err != nil {
+		return nil, err
+	}
+	if ca.Subject.CommonName != commonName || !ca.IsCA {
+		return nil, fmt.Errorf("root CA: %s, CA %t", ca.Subject, ca.IsCA)
+	}
+
+	_, err = logical.WriteWithContext(ctx, path+"/roles/web", map[string]any{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"max_ttl":          "72h",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cert, serial, err := issuePKICert(ctx, client, path, "www.example.com")
+	if err != nil {
+		return nil, err
+	}
+	err = verifyPKICert(ca, cert, "www.example.com")
+	if err != nil {
+		return nil, err
+	}
+	other, _, err := issuePKICert(ctx, client, path, "api.example.com")
+	if err != nil {
+		return nil, err
+	}
+	_, _, err = issuePKICert(ctx, client, path, "www.example.org")
+	if err == nil {
+		return nil, fmt.Errorf("certificate for www.example.org issued by role web")
+	}
+
+	// only the revoked certificate is in the CRL
+	_, err = logical.WriteWithContext(ctx, path+"/revoke", map[string]any{
+		"serial_number": serial,
+	})
+	if err != nil {
+		return nil, err
+	}
+	crl, err := readPKICRL(ctx, client, path)
+	if err != nil {
+		return nil, err
+	}
+	if err = crl.CheckSignatureFrom(ca); err != nil {
+		return nil, err
+	}
+	if !isPKIRevoked(crl, cert) {
+		return nil, fmt.Errorf("revoked certificate %s not in the CRL", serial)
+	}
+	if isPKIRevoked(crl, other) {
+		return nil, fmt.Errorf("certificate %s in the CRL", other.SerialNumber)
+	}
+	return ca, nil
+}
+
+// issuePKICert issues a certificate for commonName through the role web, and returns it with its serial number.
+func issuePKICert(ctx context.Context, client *api.Client, path, commonName string) (*x509.Certificate, string, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, path+"/issue/web", map[string]any{
+		"common_name": commonName,
+		"ttl":         "1h",
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["certificate"] == nil || secret.Data["serial_number"] == nil {
+		return nil, "", fmt.Errorf("issue %s: %+v", commonName, secret)
+	}
+	cert, err := parsePKICert(secret.Data["certificate"].(string))
+	if err != nil {
+		return nil, "", err
+	}
+	return cert, secret.Data["serial_number"].(string), nil
+}
+
+// verifyPKICert verifies the chain of cert up to the root ca, for the DNS name.
+func verifyPKICert(ca, cert *x509.Certificate, dnsName string) error {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	_, err := cert.Verify(x509.VerifyOptions{
+		DNSName: dnsName,
+		Roots:   roots,
+	})
+	return err
+}
+
+// listPKIIssuers returns the issuer IDs of the pki mount.
+func listPKIIssuers(ctx context.Context, client *api.Client, path string) ([]any, error) {
+	secret, err := client.Logical().ListWithContext(ctx, path+"/issuers")
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["keys"] == nil {
+		return nil, fmt.Errorf("issuers of %s: %+v", path, secret)
+	}
+	return secret.Data["keys"].([]any), nil
+}
+
+// readPKICRL reads and parses the CRL of the pki mount.
+func readPKICRL(ctx context.Context, client *api.Client, path string) (*x509.RevocationList, error) {
+	secret, err := client.Logical().ReadWithContext(ctx, path+"/cert/crl")
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["certificate"] == nil {
+		return nil, fmt.Errorf("CRL of %s: %+v", path, secret)
+	}
+	block, _ := pem.Decode([]byte(secret.Data["certificate"].(string)))
+	if block == nil {
+		return nil, fmt.Errorf("CRL of %s: no PEM block", path)
+	}
+	return x509.ParseRevocationList(block.Bytes)
+}
+
+// isPKIRevoked tells whether cert is in the CRL.
+func isPKIRevoked(crl *x509.RevocationList, cert *x509.Certificate) bool {
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePKICert parses a PEM encoded certificate.
+func parsePKICert(s string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block in %q", s)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -0,0 +1,44 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestPKIRoot tests the PKI secrets engine at the root namespace.
+func TestPKIRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPKIRoot(client)
+	if err != nil {
+		t.Fatalf("PKIRoot failed: %v", err)
+	}
+}
+
+// TestPKINamespace tests the PKI secrets engine in a specific namespace.
+func TestPKINamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPKINamespace(client)
+	if err != nil {
+		t.Fatalf("PKINamespace failed: %v", err)
+	}
+}
+
+// TestPKIMix tests that certificate authorities in different namespaces are isolated.
+func TestPKIMix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPKIMix(client)
+	if err != nil {
+		t.Fatalf("PKIMix failed: %v", err)
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/openbao/openbao/api/v2"
 )
@@ -441,6 +444,647 @@ func CheckPolicyMixDeleteInRoot(client *api.Client) error {
 	return nil
 }
 
+// CheckPolicyTemplateRoot checks that templated policies give each identity access to its own paths only, in the root namespace.
+func CheckPolicyTemplateRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	path := "tmpl"
+	tokens, groupID, err := setupPolicyTemplate(ctx, client, path)
+	if err != nil {
+		return err
+	}
+	err = checkPolicyTemplate(ctx, client, path, tokens, groupID)
+	if err != nil {
+		return err
+	}
+	return dropPolicyTemplate(ctx, client, path)
+}
+
+// CheckPolicyTemplateNamespace checks that templated policies give each identity access to its own paths only, in the namespace.
+func CheckPolicyTemplateNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	path := "tmpl"
+	tokens, groupID, err := setupPolicyTemplate(ctx, clone, path)
+	if err != nil {
+		return err
+	}
+	err = checkPolicyTemplate(ctx, clone, path, tokens, groupID)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckPolicyTemplateMix checks that identically named identities in the root namespace and in the namespace
+// reach their own templated paths only in their own namespace.
+func CheckPolicyTemplateMix(client *api.Client) error {
+	ctx := context.Background()
+
+	path := "tmpl"
+	tokens, _, err := setupPolicyTemplate(ctx, client, path)
+	if err != nil {
+		return err
+	}
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+	tokensNS, _, err := setupPolicyTemplate(ctx, clone, path)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range []string{"alice", "bob"} {
+		own := "user/" + user + "/mix"
+		// the token of the root namespace in the namespace
+		err = checkKV2Access(ctx, clone, tokens[user], path, nil, []string{own})
+		if err != nil {
+			return err
+		}
+		// the token of the namespace in the root namespace
+		err = checkKV2Access(ctx, client, tokensNS[user], path, nil, []string{own})
+		if err != nil {
+			return err
+		}
+		err = checkKV2Access(ctx, clone, tokensNS[user], path, []string{own}, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = dropPolicyTemplate(ctx, client, path)
+	if err != nil {
+		return err
+	}
+	client.SetNamespace(os.Getenv("VAULT_NAMESPACE"))
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// setupPolicyTemplate mounts KV2 at path, and creates in the namespace of client a templated policy,
+// the entity alice logging in with userpass, the entity bob logging in with AppRole, and the group devs
+// having alice as its member. It returns the tokens of alice and bob, and the id of the group.
+func setupPolicyTemplate(ctx context.Context, client *api.Client, path string) (map[string]string, string, error) {
+	sys := client.Sys()
+
+	err := checkKVMount(ctx, client, path)
+	if err != nil {
+		return nil, "", err
+	}
+	name := "templated"
+	err = sys.PutPolicyWithContext(ctx, name, getTemplatedRule(path))
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, authType := range []string{"userpass", "approle"} {
+		err = sys.EnableAuthWithOptionsWithContext(ctx, authType, &api.EnableAuthOptions{
+			Type: authType,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	time.Sleep(sleeping)
+
+	alice, err := createEntity(ctx, client, "alice", map[string]string{"team": "red"})
+	if err != nil {
+		return nil, "", err
+	}
+	bob, err := createEntity(ctx, client, "bob", map[string]string{"team": "blue"})
+	if err != nil {
+		return nil, "", err
+	}
+	groupID, err := createGroup(ctx, client, "devs", nil, []string{alice})
+	if err != nil {
+		return nil, "", err
+	}
+
+	// alice logs in with userpass
+	accessor, err := getAuthAccessor(ctx, client, "userpass")
+	if err != nil {
+		return nil, "", err
+	}
+	_, err = createEntityAlias(ctx, client, alice, "alice", accessor)
+	if err != nil {
+		return nil, "", err
+	}
+	err = putUserpassUser(ctx, client, "userpass", "alice", "pass", name)
+	if err != nil {
+		return nil, "", err
+	}
+	aliceToken, err := loginUserpass(ctx, client, "userpass", "alice", "pass")
+	if err != nil {
+		return nil, "", err
+	}
+
+	// bob logs in with AppRole, whose alias name is the role id
+	accessor, err = getAuthAccessor(ctx, client, "approle")
+	if err != nil {
+		return nil, "", err
+	}
+	roleID, secretID, err := putApproleRole(ctx, client, "approle", "bob", map[string]any{
+		"policies": []string{name},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	_, err = createEntityAlias(ctx, client, bob, roleID, accessor)
+	if err != nil {
+		return nil, "", err
+	}
+	bobToken, err := loginApprole(ctx, client, "approle", roleID, secretID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return map[string]string{"alice": aliceToken, "bob": bobToken}, groupID, nil
+}
+
+// checkPolicyTemplate checks that alice and bob reach only the paths templated by their entity name,
+// their entity metadata and their group membership.
+func checkPolicyTemplate(ctx context.Context, client *api.Client, path string, tokens map[string]string, groupID string) error {
+	err := checkKV2Access(ctx, client, tokens["alice"], path,
+		[]string{"user/alice/a", "team/red/a", "group/" + groupID + "/a"},
+		[]string{"user/bob/a", "team/blue/a"})
+	if err != nil {
+		return err
+	}
+	return checkKV2Access(ctx, client, tokens["bob"], path,
+		[]string{"user/bob/b", "team/blue/b"},
+		[]string{"user/alice/b", "team/red/b", "group/" + groupID + "/b"})
+}
+
+// dropPolicyTemplate removes what setupPolicyTemplate has created in the namespace of client.
+func dropPolicyTemplate(ctx context.Context, client *api.Client, path string) error {
+	sys := client.Sys()
+	logical := client.Logical()
+
+	for _, p := range []string{"identity/group/name/devs", "identity/entity/name/alice", "identity/entity/name/bob"} {
+		_, err := logical.DeleteWithContext(ctx, p)
+		if err != nil {
+			return err
+		}
+	}
+	for _, authType := range []string{"userpass", "approle"} {
+		err := sys.DisableAuthWithContext(ctx, authType)
+		if err != nil {
+			return err
+		}
+	}
+	err := sys.DeletePolicyWithContext(ctx, "templated")
+	if err != nil {
+		return err
+	}
+	return sys.UnmountWithContext(ctx, path)
+}
+
+// checkKV2Access checks that the token can write and read the allowed secrets in the KV2 engine at path,
+// and is denied writing the denied secrets.
+func checkKV2Access(ctx context.Context, client *api.Client, token, path string, allowed, denied []string) error {
+	tokenClient, err := newTokenClient(client, token)
+	if err != nil {
+		return err
+	}
+	kv2 := tokenClient.KVv2(path)
+
+	for _, name := range allowed {
+		_, err = kv2.Put(ctx, name, map[string]any{
+			"username": "myadmin",
+		})
+		if err != nil {
+			return fmt.Errorf("write %s in %s: %w", name, tokenClient.Namespace(), err)
+		}
+		kvSecret, err := kv2.Get(ctx, name)
+		if err != nil {
+			return fmt.Errorf("read %s in %s: %w", name, tokenClient.Namespace(), err)
+		}
+		if kvSecret.Data == nil || kvSecret.Data["username"] != "myadmin" {
+			return fmt.Errorf("KV secret %s: %#v", name, kvSecret.Data)
+		}
+	}
+	for _, name := range denied {
+		_, err = kv2.Put(ctx, name, map[string]any{
+			"username": "myadmin",
+		})
+		if err == nil || !strings.Contains(err.Error(), "permission denied") {
+			return fmt.Errorf("write %s in %s should be denied: %v", name, tokenClient.Namespace(), err)
+		}
+	}
+	return nil
+}
+
+// CheckPolicyParametersRoot checks the parameter constraints, wrapping TTL limits and explicit deny of policies in the root namespace.
+func CheckPolicyParametersRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	return checkPolicyParameters(ctx, client, "params")
+}
+
+// CheckPolicyParametersNamespace checks the parameter constraints, wrapping TTL limits and explicit deny of policies in the namespace.
+func CheckPolicyParametersNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	err = checkPolicyParameters(ctx, clone, "params")
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkPolicyParameters mounts KV1 at path in the namespace of client, since constraints apply
+// to the top-level request parameters, and checks the fine-grained policies on it.
+func checkPolicyParameters(ctx context.Context, client *api.Client, path string) error {
+	sys := client.Sys()
+	logical := client.Logical()
+	rootToken := client.Token()
+
+	err := sys.MountWithContext(ctx, path, &api.MountInput{
+		Type: "kv",
+	})
+	if err != nil {
+		return err
+	}
+	time.Sleep(sleeping)
+	_, err = logical.WriteWithContext(ctx, path+"/wrapped", map[string]any{
+		"username": "myadmin",
+	})
+	if err != nil {
+		return err
+	}
+
+	for name, rule := range map[string]string{
+		"params": getParametersRule(path),
+		"grant":  getGrantRule(path),
+		"deny":   getDenyRule(path),
+	} {
+		err = sys.PutPolicyWithContext(ctx, name, rule)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, secret, err := getTokenAuthSecret(ctx, client, rootToken, "params")
+	if err != nil {
+		return err
+	}
+	tokenClient, err := newTokenClient(client, secret.Auth.ClientToken)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range []struct {
+		path    string
+		data    map[string]any
+		allowed bool
+	}{
+		{path + "/allowed", map[string]any{"color": "red"}, true},
+		{path + "/allowed", map[string]any{"color": "blue", "size": "any"}, true},
+		{path + "/allowed", map[string]any{"color": "green"}, false},
+		{path + "/allowed", map[string]any{"shape": "round"}, false},
+		{path + "/denied", map[string]any{"username": "myadmin"}, true},
+		{path + "/denied", map[string]any{"username": "myadmin", "password": "123456"}, false},
+		{path + "/required", map[string]any{"owner": "myadmin", "color": "red"}, true},
+		{path + "/required", map[string]any{"color": "red"}, false},
+	} {
+		_, err = tokenClient.Logical().WriteWithContext(ctx, c.path, c.data)
+		if c.allowed && err != nil {
+			return fmt.Errorf("write %s %v: %w", c.path, c.data, err)
+		}
+		if !c.allowed && (err == nil || !strings.Contains(err.Error(), "permission denied")) {
+			return fmt.Errorf("write %s %v should be denied: %v", c.path, c.data, err)
+		}
+	}
+
+	// the secret can only be read wrapped, with a TTL between the limits
+	for ttl, allowed := range map[string]bool{"": false, "5s": false, "30s": true, "120s": false} {
+		wrapClient, err := newTokenClient(tokenClient, tokenClient.Token())
+		if err != nil {
+			return err
+		}
+		wrapClient.SetWrappingLookupFunc(func(string, string) string {
+			return ttl
+		})
+		secret, err := wrapClient.Logical().ReadWithContext(ctx, path+"/wrapped")
+		if allowed && (err != nil || secret == nil || secret.WrapInfo == nil) {
+			return fmt.Errorf("read wrapped with TTL %q: %+v %v", ttl, secret, err)
+		}
+		if !allowed && (err == nil || !strings.Contains(err.Error(), "permission denied")) {
+			return fmt.Errorf("read wrapped with TTL %q should be denied: %v", ttl, err)
+		}
+	}
+
+	// an explicit deny overrides the grant of another policy
+	for _, policies := range [][]string{{"grant"}, {"grant", "deny"}} {
+		_, secret, err = getTokenAuthSecret(ctx, client, rootToken, policies...)
+		if err != nil {
+			return err
+		}
+		tokenClient, err = newTokenClient(client, secret.Auth.ClientToken)
+		if err != nil {
+			return err
+		}
+		_, err = tokenClient.Logical().WriteWithContext(ctx, path+"/secret", map[string]any{
+			"username": "myadmin",
+		})
+		if len(policies) == 1 && err != nil {
+			return err
+		}
+		if len(policies) == 2 && (err == nil || !strings.Contains(err.Error(), "permission denied")) {
+			return fmt.Errorf("write with %v should be denied: %v", policies, err)
+		}
+	}
+
+	// clean up
+	for _, name := range []string{"params", "grant", "deny"} {
+		err = sys.DeletePolicyWithContext(ctx, name)
+		if err != nil {
+			return err
+		}
+	}
+	return sys.UnmountWithContext(ctx, path)
+}
+
+// CheckPolicyRoundTripRoot checks that policies are stored verbatim, and malformed ones rejected, in the root namespace.
+func CheckPolicyRoundTripRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	return checkPolicyRoundTrip(ctx, client, "")
+}
+
+// CheckPolicyRoundTripNamespace checks that policies are stored verbatim, and malformed ones rejected, in the namespace.
+// The policies in the namespace carry a different comment than the identically named ones in the root namespace.
+func CheckPolicyRoundTripNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	sys := client.Sys()
+	corpus := getPolicyCorpus("# root namespace")
+	for name, rules := range corpus {
+		err := sys.PutPolicyWithContext(ctx, name, rules)
+		if err != nil {
+			return err
+		}
+	}
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+	err = checkPolicyRoundTrip(ctx, clone, "# namespace "+rootNS)
+	if err != nil {
+		return err
+	}
+
+	// the root namespace keeps its own policies
+	for name, rules := range corpus {
+		stored, err := sys.GetPolicyWithContext(ctx, name)
+		if err != nil {
+			return err
+		}
+		if stored != rules {
+			return fmt.Errorf("policy %s in the root namespace: %q", name, stored)
+		}
+		err = sys.DeletePolicyWithContext(ctx, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	client.SetNamespace(os.Getenv("VAULT_NAMESPACE"))
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkPolicyRoundTrip writes the policy corpus, with the given header, in the namespace of client,
+// reads it back with GetPolicy and sys/policies/acl, then writes the malformed policies.
+func checkPolicyRoundTrip(ctx context.Context, client *api.Client, header string) error {
+	sys := client.Sys()
+	logical := client.Logical()
+
+	corpus := getPolicyCorpus(header)
+	for name, rules := range corpus {
+		err := sys.PutPolicyWithContext(ctx, name, rules)
+		if err != nil {
+			return fmt.Errorf("put policy %s: %w", name, err)
+		}
+	}
+
+	secret, err := logical.ListWithContext(ctx, "sys/policies/acl")
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["keys"] == nil {
+		return fmt.Errorf("no policy list")
+	}
+	keys := secret.Data["keys"].([]any)
+
+	for name, rules := range corpus {
+		if !slices.Contains(keys, any(name)) {
+			return fmt.Errorf("policy %s not in %v", name, keys)
+		}
+		stored, err := sys.GetPolicyWithContext(ctx, name)
+		if err != nil {
+			return err
+		}
+		if stored != rules {
+			return fmt.Errorf("policy %s from GetPolicy: %q", name, stored)
+		}
+		secret, err = logical.ReadWithContext(ctx, "sys/policies/acl/"+name)
+		if err != nil {
+			return err
+		}
+		if secret == nil || secret.Data == nil || secret.Data["policy"] != rules {
+			return fmt.Errorf("policy %s from sys/policies/acl: %+v", name, secret)
+		}
+	}
+
+	for name, rules := range getMalformedPolicies() {
+		err = sys.PutPolicyWithContext(ctx, name, rules)
+		err = checkExpectedError(ctx, client, errMalformedPolicy, err)
+		if err != nil {
+			return fmt.Errorf("policy %s: %w", name, err)
+		}
+		stored, err := sys.GetPolicyWithContext(ctx, name)
+		if err == nil && stored != "" {
+			return fmt.Errorf("malformed policy %s stored: %q", name, stored)
+		}
+	}
+
+	for name := range corpus {
+		err = sys.DeletePolicyWithContext(ctx, name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPolicyCorpus returns policies, by name, which the server is expected to store verbatim.
+func getPolicyCorpus(header string) map[string]string {
+	return map[string]string{
+		"comments": header + `
+# a hash comment
+// a slash comment
+/* a block
+   comment */
+path "secret/data/comments" {
+	capabilities = ["read"] # trailing comment
+}
+`,
+		"heredoc": header + `
+path "secret/data/heredoc" {
+	capabilities = ["create", "update"]
+	allowed_parameters = {
+		"motd" = [<<EOT
+hello
+world
+EOT
+		]
+	}
+}
+`,
+		"json": `{
+  "path": {
+    "secret/data/json/*": {
+      "capabilities": ["read", "list"]
+    }
+  }
+}`,
+		"duplicate": header + `
+path "secret/data/duplicate" {
+	capabilities = ["read"]
+}
+path "secret/data/duplicate" {
+	capabilities = ["update"]
+}
+`,
+		"unicode": header + `
+path "secret/data/ünïcødé/日本語/*" {
+	capabilities = ["read"]
+}
+`,
+	}
+}
+
+// getMalformedPolicies returns policies, by name, which the server is expected to reject.
+func getMalformedPolicies() map[string]string {
+	return map[string]string{
+		"unclosed": `path "secret/data/unclosed" {
+	capabilities = ["read"]
+`,
+		"badcapability": `path "secret/data/badcapability" {
+	capabilities = ["fly"]
+}
+`,
+		"badjson": `{"path": {"secret/data/badjson": {"capabilities": ["read"]}}`,
+		"unknownkey": `path "secret/data/unknownkey" {
+	capabilities = ["read"]
+	colour = "red"
+}
+`,
+	}
+}
+
+// getParametersRule returns the ACL policy constraining the parameters and the wrapping TTL of KV1 requests.
+func getParametersRule(path string) string {
+	return `
+	# Allow only some colors, and any size
+	path "` + path + `/allowed" {
+		capabilities = ["create", "update"]
+		allowed_parameters = {
+			"color" = ["red", "blue"]
+			"size"  = []
+		}
+	}
+	# Allow anything but a password
+	path "` + path + `/denied" {
+		capabilities = ["create", "update"]
+		denied_parameters = {
+			"password" = []
+		}
+	}
+	# Require an owner
+	path "` + path + `/required" {
+		capabilities = ["create", "update"]
+		required_parameters = ["owner"]
+	}
+	# Allow reading only as a response-wrapped secret
+	path "` + path + `/wrapped" {
+		capabilities = ["read"]
+		min_wrapping_ttl = "10s"
+		max_wrapping_ttl = "60s"
+	}
+	`
+}
+
+// getGrantRule returns the ACL policy granting access to the KV1 secret.
+func getGrantRule(path string) string {
+	return `
+	path "` + path + `/secret" {
+		capabilities = ["read", "create", "update"]
+	}
+	`
+}
+
+// getDenyRule returns the ACL policy denying access to the KV1 secret.
+func getDenyRule(path string) string {
+	return `
+	path "` + path + `/secret" {
+		capabilities = ["deny"]
+	}
+	`
+}
+
+// getTemplatedRule returns the ACL policy granting KV2 paths templated by the identity of the token.
+func getTemplatedRule(path string) string {
+	return `
+	# Allow user to manage secrets under the entity name
+	path "` + path + `/data/user/{{identity.entity.name}}/*" {
+		capabilities = ["read", "create", "update"]
+	}
+	# Allow user to manage secrets under the team in the entity metadata
+	path "` + path + `/data/team/{{identity.entity.metadata.team}}/*" {
+		capabilities = ["read", "create", "update"]
+	}
+	# Allow members of the group devs to manage secrets under the group id
+	path "` + path + `/data/group/{{identity.groups.names.devs.id}}/*" {
+		capabilities = ["read", "create", "update"]
+	}
+	`
+}
+
 func getReadApproleRule() string {
 	return `
 	path "auth/approle/role/*" {
@@ -540,3 +1184,12 @@ func getDefaultRule() string {
 		}
 	`
 }
+
+// getRewrapRule returns the ACL policy for rewrapping a response-wrapping token, which the default policy lacks.
+func getRewrapRule() string {
+	return `
+		path "sys/wrapping/rewrap" {
+		    capabilities = ["update"]
+		}
+	`
+}
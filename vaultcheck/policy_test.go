@@ -81,3 +81,94 @@ func TestPolicyMixDeleteInRoot(t *testing.T) {
 		t.Fatalf("PolicyMixDeleteInRoot failed: %v", err)
 	}
 }
+
+// TestPolicyTemplateRoot tests the templated policies with identity parameters at the root namespace.
+func TestPolicyTemplateRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPolicyTemplateRoot(client)
+	if err != nil {
+		t.Fatalf("PolicyTemplateRoot failed: %v", err)
+	}
+}
+
+// TestPolicyTemplateNamespace tests the templated policies with identity parameters in a specific namespace.
+func TestPolicyTemplateNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPolicyTemplateNamespace(client)
+	if err != nil {
+		t.Fatalf("PolicyTemplateNamespace failed: %v", err)
+	}
+}
+
+// TestPolicyTemplateMix tests the templated policies of identically named identities in the root namespace and a namespace.
+func TestPolicyTemplateMix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPolicyTemplateMix(client)
+	if err != nil {
+		t.Fatalf("PolicyTemplateMix failed: %v", err)
+	}
+}
+
+// TestPolicyParametersRoot tests the fine-grained policy constraints at the root namespace.
+func TestPolicyParametersRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPolicyParametersRoot(client)
+	if err != nil {
+		t.Fatalf("PolicyParametersRoot failed: %v", err)
+	}
+}
+
+// TestPolicyParametersNamespace tests the fine-grained policy constraints in a specific namespace.
+func TestPolicyParametersNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPolicyParametersNamespace(client)
+	if err != nil {
+		t.Fatalf("PolicyParametersNamespace failed: %v", err)
+	}
+}
+
+// TestPolicyRoundTripRoot tests that policies are stored verbatim at the root namespace.
+func TestPolicyRoundTripRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPolicyRoundTripRoot(client)
+	if err != nil {
+		t.Fatalf("PolicyRoundTripRoot failed: %v", err)
+	}
+}
+
+// TestPolicyRoundTripNamespace tests that policies are stored verbatim in a specific namespace.
+func TestPolicyRoundTripNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckPolicyRoundTripNamespace(client)
+	if err != nil {
+		t.Fatalf("PolicyRoundTripNamespace failed: %v", err)
+	}
+}
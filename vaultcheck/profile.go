@@ -0,0 +1,162 @@
+package vaultcheck
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// ProfileEnv names the environment variable which overrides the detected server flavour,
+// e.g. "openbao" or "vault".
+const ProfileEnv = "NSCHECK_PROFILE"
+
+// keys of the expected errors declared in the compatibility profiles.
+const (
+	errDisableTokenAuth = "disable-token-auth"
+	errMalformedPolicy  = "malformed-policy"
+	errLeaseCountQuota  = "lease-count-quota"
+	errNamespaceAudit   = "namespace-audit"
+)
+
+// expectedError is an error response the server is expected to return.
+type expectedError struct {
+	statusCode int
+	pattern    *regexp.Regexp
+}
+
+// serverProfile declares the expected errors of a server flavour from minVersion on, where they differ
+// from defaultErrors. A feature the flavour lacks is declared as the error refusing it.
+type serverProfile struct {
+	flavour    string
+	minVersion string
+	errors     map[string]expectedError
+}
+
+// defaultErrors are the expected errors shared by all the server flavours.
+var defaultErrors = map[string]expectedError{
+	errDisableTokenAuth: {400, regexp.MustCompile(`token credential backend cannot be disabled`)},
+	errMalformedPolicy:  {400, regexp.MustCompile(`failed to parse policy`)},
+	errNamespaceAudit:   {404, regexp.MustCompile(`unsupported path`)},
+}
+
+// profiles are ordered from the most specific to the least specific for each flavour.
+var profiles = []*serverProfile{
+	{
+		flavour:    "openbao",
+		minVersion: "2.0.0",
+		errors: map[string]expectedError{
+			errLeaseCountQuota: {404, regexp.MustCompile(`unsupported path`)},
+		},
+	},
+	{
+		flavour: "vault",
+	},
+}
+
+// lookup returns the expected error declared under key in the profile, or else in defaultErrors.
+func (p *serverProfile) lookup(key string) (expectedError, bool) {
+	if expected, ok := p.errors[key]; ok {
+		return expected, true
+	}
+	expected, ok := defaultErrors[key]
+	return expected, ok
+}
+
+func (p *serverProfile) String() string {
+	if p.minVersion == "" {
+		return p.flavour
+	}
+	return p.flavour + ">=" + p.minVersion
+}
+
+// getProfile detects the flavour and version of the server and returns the matching profile.
+// OpenBao started its versions at 2.0.0, so any 1.x server is taken as Vault.
+func getProfile(ctx context.Context, client *api.Client) (*serverProfile, error) {
+	clone, err := client.Clone()
+	if err != nil {
+		return nil, err
+	}
+	clone.ClearNamespace()
+	status, err := clone.Sys().SealStatusWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	version := strings.TrimPrefix(status.Version, "v")
+	if i := strings.IndexAny(version, "+-"); i >= 0 {
+		version = version[:i]
+	}
+
+	flavour := os.Getenv(ProfileEnv)
+	if flavour == "" {
+		flavour = "openbao"
+		if compareVersions(version, "2.0.0") < 0 {
+			flavour = "vault"
+		}
+	}
+
+	for _, p := range profiles {
+		if p.flavour == flavour && compareVersions(version, p.minVersion) >= 0 {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("no profile for %s version %s", flavour, status.Version)
+}
+
+// expectsError tells whether the server profile, or the defaults, declare the expected error under key.
+func expectsError(ctx context.Context, client *api.Client, key string) (bool, error) {
+	p, err := getProfile(ctx, client)
+	if err != nil {
+		return false, err
+	}
+	_, ok := p.lookup(key)
+	return ok, nil
+}
+
+// checkExpectedError checks that err is the error declared under key in the server profile or the defaults.
+func checkExpectedError(ctx context.Context, client *api.Client, key string, err error) error {
+	if err == nil {
+		return fmt.Errorf("%s: should have failed", key)
+	}
+	rErr, ok := err.(*api.ResponseError)
+	if !ok {
+		return err
+	}
+
+	p, err := getProfile(ctx, client)
+	if err != nil {
+		return err
+	}
+	expected, ok := p.lookup(key)
+	if !ok {
+		return fmt.Errorf("no expected error %s in profile %s", key, p)
+	}
+	if rErr.StatusCode != expected.statusCode || !slices.ContainsFunc(rErr.Errors, expected.pattern.MatchString) {
+		return fmt.Errorf("%s in profile %s: expected %d %q, got %d %#v", key, p, expected.statusCode, expected.pattern, rErr.StatusCode, rErr.Errors)
+	}
+	return nil
+}
+
+// compareVersions compares two dotted versions numerically; an empty version is the lowest.
+func compareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
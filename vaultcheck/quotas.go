@@ -0,0 +1,199 @@
+package vaultcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// CheckQuotas checks that a rate-limit quota on the namespace pname, and one on the mount kva of the namespace
+// qname, answer 429 to concurrent traffic in their scope only, while the root namespace and the mount kvb of qname
+// are unaffected; and likewise that a lease-count quota on pname limits the tokens of pname only,
+// or that the server refuses it as its profile declares.
+func CheckQuotas(client *api.Client) error {
+	ctx := context.Background()
+
+	// quotas are managed in the root namespace, with paths starting with their namespace
+	rootClient, err := newTokenClient(client, client.Token())
+	if err != nil {
+		return err
+	}
+	rootClient.ClearNamespace()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+	siblingNS := "qname"
+	sibling, err := cloneClient(ctx, client, siblingNS)
+	if err != nil {
+		return err
+	}
+
+	type target struct {
+		client *api.Client
+		path   string
+		scoped bool
+	}
+	targets := []target{
+		{client, "quotakv", false},
+		{clone, "quotakv", true},
+		{sibling, "kva", true},
+		{sibling, "kvb", false},
+	}
+	for _, t := range targets {
+		err = t.client.Sys().MountWithContext(ctx, t.path, &api.MountInput{
+			Type: "kv",
+		})
+		if err != nil {
+			return err
+		}
+		time.Sleep(sleeping)
+		_, err = t.client.Logical().WriteWithContext(ctx, t.path+"/mysecret", map[string]any{
+			"username": "myadmin",
+			"password": "123456",
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// rate-limit quotas of 10 requests a minute
+	quotas := map[string]string{
+		"nsrate":    combinedPath(rootNS) + "/",
+		"mountrate": combinedPath(siblingNS) + "/kva/",
+	}
+	for name, path := range quotas {
+		_, err = rootClient.Logical().WriteWithContext(ctx, "sys/quotas/rate-limit/"+name, map[string]any{
+			"path":     path,
+			"rate":     10,
+			"interval": "1m",
+		})
+		if err != nil {
+			return err
+		}
+		secret, err := rootClient.Logical().ReadWithContext(ctx, "sys/quotas/rate-limit/"+name)
+		if err != nil {
+			return err
+		}
+		if secret == nil || secret.Data == nil || secret.Data["path"] != path || fmt.Sprint(secret.Data["rate"]) != "10" {
+			return fmt.Errorf("rate-limit quota %s: %+v", name, secret)
+		}
+	}
+	for _, t := range targets {
+		limited, err := driveQuotaTraffic(ctx, t.client, t.path+"/mysecret", 4, 10)
+		if err != nil {
+			return err
+		}
+		if (limited > 0) != t.scoped {
+			return fmt.Errorf("%d requests rate limited at %s in %q", limited, t.path, t.client.Namespace())
+		}
+	}
+	for name := range quotas {
+		_, err = rootClient.Logical().DeleteWithContext(ctx, "sys/quotas/rate-limit/"+name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// a lease-count quota of 3 leases, unless the server profile declares lease-count quotas unsupported
+	unsupported, err := expectsError(ctx, rootClient, errLeaseCountQuota)
+	if err != nil {
+		return err
+	}
+	_, err = rootClient.Logical().WriteWithContext(ctx, "sys/quotas/lease-count/nsleases", map[string]any{
+		"path":       combinedPath(rootNS) + "/",
+		"max_leases": 3,
+	})
+	var rErr *api.ResponseError
+	switch {
+	case unsupported:
+		err = checkExpectedError(ctx, rootClient, errLeaseCountQuota, err)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		for _, c := range []struct {
+			client   *api.Client
+			expected int
+		}{
+			{clone, 3},
+			{sibling, 5},
+		} {
+			created := 0
+			for range 5 {
+				_, err = c.client.Auth().Token().CreateWithContext(ctx, &api.TokenCreateRequest{
+					TTL: "1h",
+				})
+				if errors.As(err, &rErr) && rErr.StatusCode == http.StatusTooManyRequests {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				created++
+			}
+			if created != c.expected {
+				return fmt.Errorf("%d tokens created in %q, expected %d", created, c.client.Namespace(), c.expected)
+			}
+		}
+		_, err = rootClient.Logical().DeleteWithContext(ctx, "sys/quotas/lease-count/nsleases")
+		if err != nil {
+			return err
+		}
+	}
+
+	// clean up
+	err = client.Sys().UnmountWithContext(ctx, "quotakv")
+	if err != nil {
+		return err
+	}
+	for _, ns := range []string{rootNS, siblingNS} {
+		_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+ns)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// driveQuotaTraffic reads the path from concurrent clients, each making the given number of requests
+// without retries, and returns how many requests were answered 429.
+func driveQuotaTraffic(ctx context.Context, client *api.Client, path string, clients, requests int) (int, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	limited := 0
+	var errs []error
+	for range clients {
+		c, err := newTokenClient(client, client.Token())
+		if err != nil {
+			return 0, err
+		}
+		c.SetMaxRetries(0)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range requests {
+				_, err := c.Logical().ReadWithContext(ctx, path)
+				mu.Lock()
+				var rErr *api.ResponseError
+				if errors.As(err, &rErr) && rErr.StatusCode == http.StatusTooManyRequests {
+					limited++
+				} else if err != nil {
+					errs = append(errs, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return limited, errors.Join(errs...)
+}
@@ -0,0 +1,18 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestQuotas tests that rate-limit and lease-count quotas only affect their scoped namespace and mount.
+func TestQuotas(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckQuotas(client)
+	if err != nil {
+		t.Fatalf("Quotas failed: %v", err)
+	}
+}
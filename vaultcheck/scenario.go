@@ -0,0 +1,329 @@
+package vaultcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hashicorp/hcl"
+	"github.com/openbao/openbao/api/v2"
+)
+
+// aclScenario is a declarative ACL scenario, read from an HCL file. Namespaces are relative
+// to the root namespace, which is written as "". See testdata/scenarios for examples.
+type aclScenario struct {
+	Namespaces []string            `hcl:"namespaces"`
+	Mounts     []*scenarioMount    `hcl:"mount"`
+	Policies   []*scenarioPolicy   `hcl:"policy"`
+	Identities []*scenarioIdentity `hcl:"identity"`
+	Expects    []*scenarioExpect   `hcl:"expect"`
+}
+
+// scenarioMount is a secrets engine mounted in each of the namespaces, holding the secrets.
+type scenarioMount struct {
+	Path       string   `hcl:",key"`
+	Type       string   `hcl:"type"`
+	Namespaces []string `hcl:"namespaces"`
+	Secrets    []string `hcl:"secrets"`
+}
+
+// scenarioPolicy is an ACL policy written in each of the namespaces.
+type scenarioPolicy struct {
+	Name       string   `hcl:",key"`
+	Namespaces []string `hcl:"namespaces"`
+	Rules      string   `hcl:"rules"`
+}
+
+// scenarioIdentity is a token in the namespace, created directly or by a userpass login.
+type scenarioIdentity struct {
+	Name      string   `hcl:",key"`
+	Namespace string   `hcl:"namespace"`
+	Auth      string   `hcl:"auth"`
+	Policies  []string `hcl:"policies"`
+}
+
+// scenarioExpect is a row of the outcome table, labelled with the identity: whether the identity
+// is allowed the operation on the path in the namespace. The path starts with the path of a mount.
+type scenarioExpect struct {
+	Identity  string `hcl:",key"`
+	Namespace string `hcl:"namespace"`
+	Operation string `hcl:"operation"`
+	Path      string `hcl:"path"`
+	Allowed   bool   `hcl:"allowed"`
+}
+
+var scenarioOperations = []string{"read", "write", "list", "delete"}
+
+// CheckACLScenarios runs every ACL scenario file *.hcl in the directory.
+func CheckACLScenarios(client *api.Client, dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.hcl"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no scenario in %s", dir)
+	}
+	for _, fn := range files {
+		err = CheckACLScenario(client, fn)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+	}
+	return nil
+}
+
+// CheckACLScenario sets up the namespaces, mounts, policies and identities of the scenario file,
+// runs every expected operation, and reports all unexpected outcomes as a table.
+func CheckACLScenario(client *api.Client, filename string) error {
+	ctx := context.Background()
+
+	scenario, err := readACLScenario(filename)
+	if err != nil {
+		return err
+	}
+
+	rootToken := client.Token()
+	namespaces := append([]string{""}, scenario.Namespaces...)
+	clients := map[string]*api.Client{"": client}
+	for _, ns := range scenario.Namespaces {
+		parent, name := splitNamespace(ns)
+		clone, err := cloneClient(ctx, clients[parent], name)
+		if err != nil {
+			return err
+		}
+		clients[ns] = clone
+	}
+
+	mounts := make(map[string]*scenarioMount)
+	for _, m := range scenario.Mounts {
+		mounts[m.Path] = m
+		for _, ns := range m.Namespaces {
+			c := clients[ns]
+			err = c.Sys().MountWithContext(ctx, m.Path, &api.MountInput{
+				Type: m.Type,
+			})
+			if err != nil {
+				return err
+			}
+			time.Sleep(sleeping)
+			for _, title := range m.Secrets {
+				err = doScenarioOperation(ctx, c, m, "write", title)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, p := range scenario.Policies {
+		for _, ns := range p.Namespaces {
+			err = clients[ns].Sys().PutPolicyWithContext(ctx, p.Name, p.Rules)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	tokens := make(map[string]string)
+	userpass := make(map[string]bool)
+	for _, id := range scenario.Identities {
+		c := clients[id.Namespace]
+		switch id.Auth {
+		case "userpass":
+			if !userpass[id.Namespace] {
+				err = c.Sys().EnableAuthWithOptionsWithContext(ctx, "userpass", &api.EnableAuthOptions{
+					Type: "userpass",
+				})
+				if err != nil {
+					return err
+				}
+				time.Sleep(sleeping)
+				userpass[id.Namespace] = true
+			}
+			err = putUserpassUser(ctx, c, "userpass", id.Name, "pass", id.Policies...)
+			if err != nil {
+				return err
+			}
+			tokens[id.Name], err = loginUserpass(ctx, c, "userpass", id.Name, "pass")
+		default:
+			var secret *api.Secret
+			_, secret, err = getTokenAuthSecret(ctx, c, rootToken, id.Policies...)
+			if err == nil {
+				tokens[id.Name] = secret.Auth.ClientToken
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var table strings.Builder
+	w := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IDENTITY\tNAMESPACE\tOPERATION\tPATH\tEXPECTED\tGOT")
+	failures := 0
+	for _, e := range scenario.Expects {
+		tokenClient, err := newTokenClient(clients[e.Namespace], tokens[e.Identity])
+		if err != nil {
+			return err
+		}
+		mountPath, title, _ := strings.Cut(e.Path, "/")
+		err = doScenarioOperation(ctx, tokenClient, mounts[mountPath], e.Operation, title)
+		if err != nil && !strings.Contains(err.Error(), "permission denied") {
+			return fmt.Errorf("%s %s %s in %q: %w", e.Identity, e.Operation, e.Path, e.Namespace, err)
+		}
+		if got := err == nil; got != e.Allowed {
+			failures++
+			fmt.Fprintf(w, "%s\t%q\t%s\t%s\t%t\t%t\n", e.Identity, e.Namespace, e.Operation, e.Path, e.Allowed, got)
+		}
+	}
+	w.Flush()
+
+	// clean up
+	for i := len(namespaces) - 1; i >= 0; i-- {
+		ns := namespaces[i]
+		c := clients[ns]
+		c.SetToken(rootToken)
+		if ns != "" {
+			parent, name := splitNamespace(ns)
+			_, err = clients[parent].Logical().DeleteWithContext(ctx, "sys/namespaces/"+name)
+			if err != nil {
+				return err
+			}
+			time.Sleep(sleeping)
+			continue
+		}
+		for _, m := range scenario.Mounts {
+			if slices.Contains(m.Namespaces, ns) {
+				err = c.Sys().UnmountWithContext(ctx, m.Path)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for _, p := range scenario.Policies {
+			if slices.Contains(p.Namespaces, ns) {
+				err = c.Sys().DeletePolicyWithContext(ctx, p.Name)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if userpass[ns] {
+			err = c.Sys().DisableAuthWithContext(ctx, "userpass")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d unexpected outcomes:\n%s", failures, table.String())
+	}
+	return nil
+}
+
+// readACLScenario reads the scenario file and checks that everything it refers to is declared.
+func readACLScenario(filename string) (*aclScenario, error) {
+	bs, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	scenario := new(aclScenario)
+	err = hcl.Decode(scenario, string(bs))
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := append([]string{""}, scenario.Namespaces...)
+	for _, ns := range scenario.Namespaces {
+		if parent, _ := splitNamespace(ns); ns == "" || !slices.Contains(namespaces, parent) || slices.Index(namespaces, parent) > slices.Index(namespaces, ns) {
+			return nil, fmt.Errorf("namespace %q must follow its parent", ns)
+		}
+	}
+	var errs []error
+	checkNamespaces := func(kind, name string, list ...string) {
+		for _, ns := range list {
+			if !slices.Contains(namespaces, ns) {
+				errs = append(errs, fmt.Errorf("%s %s: undeclared namespace %q", kind, name, ns))
+			}
+		}
+	}
+	var mounts, identities []string
+	for _, m := range scenario.Mounts {
+		checkNamespaces("mount", m.Path, m.Namespaces...)
+		mounts = append(mounts, m.Path)
+	}
+	for _, p := range scenario.Policies {
+		checkNamespaces("policy", p.Name, p.Namespaces...)
+	}
+	for _, id := range scenario.Identities {
+		checkNamespaces("identity", id.Name, id.Namespace)
+		if !slices.Contains([]string{"", "token", "userpass"}, id.Auth) {
+			errs = append(errs, fmt.Errorf("identity %s: unknown auth %q", id.Name, id.Auth))
+		}
+		if slices.Contains(identities, id.Name) {
+			errs = append(errs, fmt.Errorf("identity %s: declared twice", id.Name))
+		}
+		identities = append(identities, id.Name)
+	}
+	for i, e := range scenario.Expects {
+		checkNamespaces("expect", fmt.Sprint(i), e.Namespace)
+		if !slices.Contains(identities, e.Identity) {
+			errs = append(errs, fmt.Errorf("expect %d: undeclared identity %q", i, e.Identity))
+		}
+		if !slices.Contains(scenarioOperations, e.Operation) {
+			errs = append(errs, fmt.Errorf("expect %d: unknown operation %q", i, e.Operation))
+		}
+		if mountPath, _, _ := strings.Cut(e.Path, "/"); !slices.Contains(mounts, mountPath) {
+			errs = append(errs, fmt.Errorf("expect %d: undeclared mount in %q", i, e.Path))
+		}
+	}
+	return scenario, errors.Join(errs...)
+}
+
+// doScenarioOperation runs the operation on the secret title of the mount. KV2 mounts are
+// accessed through their data and metadata paths, other mounts directly.
+func doScenarioOperation(ctx context.Context, client *api.Client, m *scenarioMount, operation, title string) error {
+	data := map[string]any{
+		"username": "myadmin",
+		"password": "123456",
+	}
+	if m.Type == "kv-v2" {
+		kv2 := client.KVv2(m.Path)
+		var err error
+		switch operation {
+		case "read":
+			_, err = kv2.Get(ctx, title)
+			if errors.Is(err, api.ErrSecretNotFound) {
+				err = nil
+			}
+		case "write":
+			_, err = kv2.Put(ctx, title, data)
+		case "delete":
+			err = kv2.Delete(ctx, title)
+		case "list":
+			_, err = client.Logical().ListWithContext(ctx, m.Path+"/metadata/"+title)
+		}
+		return err
+	}
+
+	logical := client.Logical()
+	var err error
+	switch operation {
+	case "read":
+		_, err = logical.ReadWithContext(ctx, m.Path+"/"+title)
+	case "write":
+		_, err = logical.WriteWithContext(ctx, m.Path+"/"+title, data)
+	case "delete":
+		_, err = logical.DeleteWithContext(ctx, m.Path+"/"+title)
+	case "list":
+		_, err = logical.ListWithContext(ctx, m.Path+"/"+title)
+	}
+	return err
+}
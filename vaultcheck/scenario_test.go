@@ -0,0 +1,18 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestACLScenarios tests every declarative ACL scenario in testdata/scenarios.
+func TestACLScenarios(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckACLScenarios(client, "testdata/scenarios")
+	if err != nil {
+		t.Fatalf("ACLScenarios failed: %v", err)
+	}
+}
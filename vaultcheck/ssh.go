@@ -0,0 +1,246 @@
+package vaultcheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/openbao/openbao/api/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+// CheckSSHRoot checks the SSH secrets engine in CA mode in the root namespace.
+func CheckSSHRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	path := "ssh"
+	_, err := checkSSH(ctx, client, path)
+	if err != nil {
+		return err
+	}
+	return client.Sys().UnmountWithContext(ctx, path)
+}
+
+// CheckSSHNamespace checks the SSH secrets engine in CA mode in the namespace.
+func CheckSSHNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	path := "ssh"
+	_, err = checkSSH(ctx, clone, path)
+	if err != nil {
+		return err
+	}
+	err = clone.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckSSHMix checks that the SSH CAs of the root namespace and of the namespace are distinct:
+// a certificate signed in one namespace is not trusted by the CA of the other, and a role
+// of one namespace is invisible in the other.
+func CheckSSHMix(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	path := "ssh"
+	rootCA, err := checkSSH(ctx, client, path)
+	if err != nil {
+		return err
+	}
+	nsCA, err := checkSSH(ctx, clone, path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(rootCA.Marshal(), nsCA.Marshal()) {
+		return fmt.Errorf("same SSH CA in the root namespace and in the namespace")
+	}
+
+	for _, c := range []struct {
+		client  *api.Client
+		other   *api.Client
+		otherCA ssh.PublicKey
+	}{
+		{client, clone, nsCA},
+		{clone, client, rootCA},
+	} {
+		cert, err := signSSHKey(ctx, c.client, path, "alice")
+		if err != nil {
+			return err
+		}
+		if err = checkSSHCert(c.otherCA, cert, "alice"); err == nil {
+			return fmt.Errorf("certificate signed in %q trusted by the CA of %q", c.client.Namespace(), c.other.Namespace())
+		}
+
+		_, err = c.client.Logical().WriteWithContext(ctx, path+"/roles/private", getSSHRole())
+		if err != nil {
+			return err
+		}
+		secret, err := c.other.Logical().ReadWithContext(ctx, path+"/roles/private")
+		if err == nil && secret != nil {
+			return fmt.Errorf("SSH role of %q read in %q: %+v", c.client.Namespace(), c.other.Namespace(), secret.Data)
+		}
+		_, err = c.client.Logical().DeleteWithContext(ctx, path+"/roles/private")
+		if err != nil {
+			return err
+		}
+	}
+
+	// clean up
+	err = clone.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	err = client.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkSSH mounts the SSH secrets engine at path in the namespace of client, generates its CA
+// and the role signer, and checks the principals and validity of a signed local public key.
+// It returns the public key of the CA.
+func checkSSH(ctx context.Context, client *api.Client, path string) (ssh.PublicKey, error) {
+	logical := client.Logical()
+
+	err := client.Sys().MountWithContext(ctx, path, &api.MountInput{
+		Type: "ssh",
+	})
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(sleeping)
+
+	secret, err := logical.WriteWithContext(ctx, path+"/config/ca", map[string]any{
+		"generate_signing_key": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["public_key"] == nil {
+		return nil, fmt.Errorf("SSH CA: %+v", secret)
+	}
+	ca, _, _, _, err := ssh.ParseAuthorizedKey([]byte(secret.Data["public_key"].(string)))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = logical.WriteWithContext(ctx, path+"/roles/signer", getSSHRole())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cert, err := signSSHKey(ctx, client, path, "alice", "bob")
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Equal(cert.ValidPrincipals, []string{"alice", "bob"}) {
+		return nil, fmt.Errorf("principals of the certificate: %v", cert.ValidPrincipals)
+	}
+	validBefore := time.Unix(int64(cert.ValidBefore), 0)
+	if validBefore.Before(now.Add(9*time.Minute)) || validBefore.After(now.Add(11*time.Minute)) {
+		return nil, fmt.Errorf("certificate valid before %s, expected about 10 minutes from %s", validBefore, now)
+	}
+	for _, principal := range []string{"alice", "bob"} {
+		err = checkSSHCert(ca, cert, principal)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = checkSSHCert(ca, cert, "carol"); err == nil {
+		return nil, fmt.Errorf("certificate valid for carol")
+	}
+
+	_, err = signSSHKey(ctx, client, path, "mallory")
+	if err == nil {
+		return nil, fmt.Errorf("certificate for mallory signed by role signer")
+	}
+	return ca, nil
+}
+
+// getSSHRole returns the options of a role signing user certificates for alice, bob and carol.
+func getSSHRole() map[string]any {
+	return map[string]any{
+		"key_type":                "ca",
+		"allow_user_certificates": true,
+		"allowed_users":           "alice,bob,carol",
+		"default_user":            "alice",
+		"ttl":                     "30m",
+		"max_ttl":                 "1h",
+	}
+}
+
+// signSSHKey generates a local ed25519 key, has its public key signed by the role signer
+// for 10 minutes with the principals, and returns the certificate.
+func signSSHKey(ctx context.Context, client *api.Client, path string, principals ...string) (*ssh.Certificate, error) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := client.Logical().WriteWithContext(ctx, path+"/sign/signer", map[string]any{
+		"public_key":       string(ssh.MarshalAuthorizedKey(sshPub)),
+		"valid_principals": strings.Join(principals, ","),
+		"cert_type":        "user",
+		"ttl":              "10m",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["signed_key"] == nil {
+		return nil, fmt.Errorf("signed key: %+v", secret)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(secret.Data["signed_key"].(string)))
+	if err != nil {
+		return nil, err
+	}
+	cert, ok := key.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("signed key is not a certificate: %s", key.Type())
+	}
+	if !bytes.Equal(cert.Key.Marshal(), sshPub.Marshal()) {
+		return nil, fmt.Errorf("certificate of another public key")
+	}
+	return cert, nil
+}
+
+// checkSSHCert checks that the user certificate is signed by ca and currently valid for the principal.
+func checkSSHCert(ca ssh.PublicKey, cert *ssh.Certificate, principal string) error {
+	if !bytes.Equal(cert.SignatureKey.Marshal(), ca.Marshal()) {
+		return fmt.Errorf("certificate signed by another CA")
+	}
+	checker := &ssh.CertChecker{}
+	return checker.CheckCert(principal, cert)
+}
@@ -0,0 +1,44 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestSSHRoot tests the SSH secrets engine in CA mode at the root namespace.
+func TestSSHRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckSSHRoot(client)
+	if err != nil {
+		t.Fatalf("SSHRoot failed: %v", err)
+	}
+}
+
+// TestSSHNamespace tests the SSH secrets engine in CA mode in a specific namespace.
+func TestSSHNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckSSHNamespace(client)
+	if err != nil {
+		t.Fatalf("SSHNamespace failed: %v", err)
+	}
+}
+
+// TestSSHMix tests that SSH certificate authorities in different namespaces are isolated.
+func TestSSHMix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckSSHMix(client)
+	if err != nil {
+		t.Fatalf("SSHMix failed: %v", err)
+	}
+}
@@ -0,0 +1,335 @@
+# The scenario of CheckACLMixPower with userpass auth: "+/" lets each token read, and the writers
+# write, one level of sub namespaces besides its own.
+
+namespaces = ["ns1", "ns1/ns2"]
+
+mount "mountPath" {
+  type       = "kv-v2"
+  namespaces = ["", "ns1", "ns1/ns2"]
+  secrets    = ["mysecret"]
+}
+
+policy "userread" {
+  namespaces = ["", "ns1", "ns1/ns2"]
+  rules      = <<EOT
+path "mountPath/config/*" {
+  capabilities = ["read"]
+}
+path "mountPath/metadata/*" {
+  capabilities = ["read", "list"]
+}
+path "mountPath/data/*" {
+  capabilities = ["read"]
+}
+path "+/mountPath/data/*" {
+  capabilities = ["read"]
+}
+EOT
+}
+
+policy "userwrite" {
+  namespaces = ["", "ns1", "ns1/ns2"]
+  rules      = <<EOT
+path "mountPath/config/*" {
+  capabilities = ["read"]
+}
+path "mountPath/metadata/*" {
+  capabilities = ["read", "list"]
+}
+path "mountPath/data/*" {
+  capabilities = ["read", "create", "update", "delete"]
+}
+path "+/mountPath/data/*" {
+  capabilities = ["read", "create", "update", "delete"]
+}
+EOT
+}
+
+identity "read0" {
+  namespace = ""
+  auth      = "userpass"
+  policies  = ["userread"]
+}
+
+identity "write0" {
+  namespace = ""
+  auth      = "userpass"
+  policies  = ["userwrite"]
+}
+
+identity "read1" {
+  namespace = "ns1"
+  auth      = "userpass"
+  policies  = ["userread"]
+}
+
+identity "write1" {
+  namespace = "ns1"
+  auth      = "userpass"
+  policies  = ["userwrite"]
+}
+
+identity "read2" {
+  namespace = "ns1/ns2"
+  auth      = "userpass"
+  policies  = ["userread"]
+}
+
+identity "write2" {
+  namespace = "ns1/ns2"
+  auth      = "userpass"
+  policies  = ["userwrite"]
+}
+
+# the outcome table: identity x namespace x operation
+expect "read0" {
+  namespace = ""
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = true
+}
+
+expect "read0" {
+  namespace = ""
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "read0" {
+  namespace = "ns1"
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = true
+}
+
+expect "read0" {
+  namespace = "ns1"
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "read0" {
+  namespace = "ns1/ns2"
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = false
+}
+
+expect "read0" {
+  namespace = "ns1/ns2"
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "write0" {
+  namespace = ""
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = true
+}
+
+expect "write0" {
+  namespace = ""
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = true
+}
+
+expect "write0" {
+  namespace = "ns1"
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = true
+}
+
+expect "write0" {
+  namespace = "ns1"
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = true
+}
+
+expect "write0" {
+  namespace = "ns1/ns2"
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = false
+}
+
+expect "write0" {
+  namespace = "ns1/ns2"
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "read1" {
+  namespace = ""
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = false
+}
+
+expect "read1" {
+  namespace = ""
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "read1" {
+  namespace = "ns1"
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = true
+}
+
+expect "read1" {
+  namespace = "ns1"
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "read1" {
+  namespace = "ns1/ns2"
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = true
+}
+
+expect "read1" {
+  namespace = "ns1/ns2"
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "write1" {
+  namespace = ""
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = false
+}
+
+expect "write1" {
+  namespace = ""
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "write1" {
+  namespace = "ns1"
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = true
+}
+
+expect "write1" {
+  namespace = "ns1"
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = true
+}
+
+expect "write1" {
+  namespace = "ns1/ns2"
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = true
+}
+
+expect "write1" {
+  namespace = "ns1/ns2"
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = true
+}
+
+expect "read2" {
+  namespace = ""
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = false
+}
+
+expect "read2" {
+  namespace = ""
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "read2" {
+  namespace = "ns1"
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = false
+}
+
+expect "read2" {
+  namespace = "ns1"
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "read2" {
+  namespace = "ns1/ns2"
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = true
+}
+
+expect "read2" {
+  namespace = "ns1/ns2"
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "write2" {
+  namespace = ""
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = false
+}
+
+expect "write2" {
+  namespace = ""
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "write2" {
+  namespace = "ns1"
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = false
+}
+
+expect "write2" {
+  namespace = "ns1"
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = false
+}
+
+expect "write2" {
+  namespace = "ns1/ns2"
+  operation = "read"
+  path      = "mountPath/mysecret"
+  allowed   = true
+}
+
+expect "write2" {
+  namespace = "ns1/ns2"
+  operation = "write"
+  path      = "mountPath/mysecret1"
+  allowed   = true
+}
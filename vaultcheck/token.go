@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"slices"
+	"time"
 
 	"github.com/openbao/openbao/api/v2"
 )
@@ -21,19 +22,16 @@ func CheckTokenRoot(client *api.Client) error {
 		return err
 	}
 
-	tokenAuth, secret, err := getTokenAuthSecret(ctx, client, rootToken, "default")
+	_, secret, err := getTokenAuthSecret(ctx, client, rootToken, "default")
 	if err != nil {
 		return err
 	}
 
 	// test revocation
-	s, err := revokeTokenByRootToken(ctx, client, tokenAuth, path, rootToken, secret.Auth.ClientToken)
+	err = revokeTokenByRootToken(ctx, client, client, path, rootToken, secret.Auth.ClientToken)
 	if err != nil {
 		return err
 	}
-	if s != nil && s.Auth != nil {
-		return fmt.Errorf("revocation failed %+v", s.Auth)
-	}
 	return nil
 }
 
@@ -55,11 +53,11 @@ func CheckTokenNamespace(client *api.Client) error {
 		return err
 	}
 
-	tokenAuth1, secret1, err := getTokenAuthSecret(ctx, clone, rootToken, "default")
+	_, secret1, err := getTokenAuthSecret(ctx, clone, rootToken, "default")
 	if err != nil {
 		return err
 	}
-	tokenAuth2, secret2, err := getTokenAuthSecret(ctx, clone, rootToken, "default")
+	_, secret2, err := getTokenAuthSecret(ctx, clone, rootToken, "default")
 	if err != nil {
 		return err
 	}
@@ -70,21 +68,15 @@ func CheckTokenNamespace(client *api.Client) error {
 		return fmt.Errorf("root Token: %s in namespace %s, clone %s in namespace %s", client.Token(), client.Namespace(), clone.Token(), clone.Namespace())
 	}
 
-	s1, err := revokeTokenByRootToken(ctx, clone, tokenAuth1, path, rootToken, secret1.Auth.ClientToken)
+	err = revokeTokenByRootToken(ctx, clone, clone, path, rootToken, secret1.Auth.ClientToken)
 	if err != nil {
 		return err
 	}
-	if s1 != nil && s1.Auth != nil {
-		return fmt.Errorf("revocation failed %+v", s1.Auth)
-	}
-	// remove a namespace token from the root namespace ... ok?
-	s2, err := revokeTokenByRootToken(ctx, client, tokenAuth2, path, rootToken, secret2.Auth.ClientToken)
+	// a token of the child namespace can be revoked from the root namespace
+	err = revokeTokenByRootToken(ctx, client, clone, path, rootToken, secret2.Auth.ClientToken)
 	if err != nil {
 		return err
 	}
-	if s2 != nil && s2.Auth != nil {
-		return fmt.Errorf("revocation failed %+v", s2.Auth)
-	}
 
 	client.SetNamespace(os.Getenv("VAULT_NAMESPACE"))
 	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
@@ -107,11 +99,11 @@ func CheckTokenMix(client *api.Client) error {
 	if err != nil {
 		return err
 	}
-	tokenAuth1, secret1, err := getTokenAuthSecret(ctx, client, rootToken, "default")
+	_, secret1, err := getTokenAuthSecret(ctx, client, rootToken, "default")
 	if err != nil {
 		return err
 	}
-	tokenAuth3, secret3, err := getTokenAuthSecret(ctx, client, rootToken, "default")
+	_, secret3, err := getTokenAuthSecret(ctx, client, rootToken, "default")
 	if err != nil {
 		return err
 	}
@@ -127,11 +119,11 @@ func CheckTokenMix(client *api.Client) error {
 	if err != nil {
 		return err
 	}
-	tokenAuth2, secret2, err := getTokenAuthSecret(ctx, clone, rootToken, "default")
+	_, secret2, err := getTokenAuthSecret(ctx, clone, rootToken, "default")
 	if err != nil {
 		return err
 	}
-	tokenAuth4, secret4, err := getTokenAuthSecret(ctx, clone, rootToken, "default")
+	_, secret4, err := getTokenAuthSecret(ctx, clone, rootToken, "default")
 	if err != nil {
 		return err
 	}
@@ -142,40 +134,151 @@ func CheckTokenMix(client *api.Client) error {
 		return fmt.Errorf("root Token: %s in namespace %s, clone %s in namespace %s", client.Token(), client.Namespace(), clone.Token(), clone.Namespace())
 	}
 
-	s1, err := revokeTokenByRootToken(ctx, client, tokenAuth1, path, rootToken, secret1.Auth.ClientToken)
+	err = revokeTokenByRootToken(ctx, client, client, path, rootToken, secret1.Auth.ClientToken)
 	if err != nil {
 		return err
 	}
-	if s1 != nil && s1.Auth != nil {
-		return fmt.Errorf("revocation failed %+v", s1.Auth)
+	err = revokeTokenByRootToken(ctx, clone, clone, path, rootToken, secret2.Auth.ClientToken)
+	if err != nil {
+		return err
 	}
-	s2, err := revokeTokenByRootToken(ctx, clone, tokenAuth2, path, rootToken, secret2.Auth.ClientToken)
+
+	// a token of the root namespace can be revoked by value from the child namespace
+	err = revokeTokenByRootToken(ctx, clone, client, path, rootToken, secret3.Auth.ClientToken)
 	if err != nil {
 		return err
 	}
-	if s2 != nil && s2.Auth != nil {
-		return fmt.Errorf("revocation failed %+v", s2.Auth)
+
+	// a token of the child namespace can be revoked from the root namespace
+	err = revokeTokenByRootToken(ctx, client, clone, path, rootToken, secret4.Auth.ClientToken)
+	if err != nil {
+		return err
+	}
+
+	// clean up
+	client.SetNamespace(os.Getenv("VAULT_NAMESPACE"))
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
 	}
+	return nil
+}
+
+// CheckTokenHierarchy checks which tokens remain valid when tokens are revoked at each level
+// of a hierarchy spanning the root namespace, a child namespace and a grandchild namespace.
+//
+// The parent token p lives in the root namespace. It creates c1, c2 and c3 in pname, and
+// each ci creates gi in pname/cname. The tokens are then revoked one level at a time.
+func CheckTokenHierarchy(client *api.Client) error {
+	ctx := context.Background()
+
+	rootToken := client.Token()
 
-	// remove a normal token in space from the namespace ... ok?
-	s3, err := revokeTokenByRootToken(ctx, clone, tokenAuth3, path, rootToken, secret3.Auth.ClientToken)
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
 	if err != nil {
 		return err
 	}
-	if s3 != nil && s3.Auth != nil {
-		return fmt.Errorf("revocation failed %+v", s3.Auth)
+	subNS := "cname"
+	clone2, err := cloneClient(ctx, clone, subNS)
+	if err != nil {
+		return err
 	}
 
-	// remove a namespace token from the root namespace ... ok?
-	s4, err := revokeTokenByRootToken(ctx, client, tokenAuth4, path, rootToken, secret4.Auth.ClientToken)
+	// the same policy name resolves to a different body in each namespace,
+	// so that the child tokens can hold a subset of their parent's policies.
+	name := "hierarchy"
+	err = client.Sys().PutPolicyWithContext(ctx, name, getTokenCreateRule(rootNS))
 	if err != nil {
 		return err
 	}
-	if s4 != nil && s4.Auth != nil {
-		return fmt.Errorf("revocation failed %+v", s4.Auth)
+	err = clone.Sys().PutPolicyWithContext(ctx, name, getTokenCreateRule(subNS))
+	if err != nil {
+		return err
+	}
+
+	tokens := make(map[string]*api.Client)
+	tokens["p"], err = createChildToken(ctx, client, rootToken, name)
+	if err != nil {
+		return err
+	}
+	for _, i := range []string{"1", "2", "3"} {
+		tokens["c"+i], err = createChildToken(ctx, clone, tokens["p"].Token(), name)
+		if err != nil {
+			return err
+		}
+		tokens["g"+i], err = createChildToken(ctx, clone2, tokens["c"+i].Token(), "default")
+		if err != nil {
+			return err
+		}
+	}
+	err = checkValidTokens(ctx, tokens, "p", "c1", "c2", "c3", "g1", "g2", "g3")
+	if err != nil {
+		return err
+	}
+
+	clone.SetToken(rootToken)
+	clone2.SetToken(rootToken)
+
+	// revoking a grandchild leaves everybody else valid
+	err = clone2.Auth().Token().RevokeTreeWithContext(ctx, tokens["g1"].Token())
+	if err != nil {
+		return err
+	}
+	err = checkValidTokens(ctx, tokens, "p", "c1", "c2", "c3", "g2", "g3")
+	if err != nil {
+		return err
+	}
+
+	// revoking a child also revokes its grandchild in the deeper namespace
+	err = clone.Auth().Token().RevokeTreeWithContext(ctx, tokens["c2"].Token())
+	if err != nil {
+		return err
+	}
+	err = checkValidTokens(ctx, tokens, "p", "c1", "c3", "g3")
+	if err != nil {
+		return err
+	}
+
+	// revoking a child as an orphan keeps its grandchild
+	err = clone.Auth().Token().RevokeOrphanWithContext(ctx, tokens["c3"].Token())
+	if err != nil {
+		return err
+	}
+	err = checkValidTokens(ctx, tokens, "p", "c1", "g3")
+	if err != nil {
+		return err
+	}
+
+	// revoking the parent in the root namespace revokes its remaining children,
+	// but not the grandchild which has become an orphan
+	err = client.Auth().Token().RevokeTreeWithContext(ctx, tokens["p"].Token())
+	if err != nil {
+		return err
+	}
+	err = checkValidTokens(ctx, tokens, "g3")
+	if err != nil {
+		return err
 	}
 
 	// clean up
+	err = clone2.Auth().Token().RevokeTreeWithContext(ctx, tokens["g3"].Token())
+	if err != nil {
+		return err
+	}
+	err = checkValidTokens(ctx, tokens)
+	if err != nil {
+		return err
+	}
+	err = client.Sys().DeletePolicyWithContext(ctx, name)
+	if err != nil {
+		return err
+	}
+	_, err = clone.Logical().DeleteWithContext(ctx, "sys/namespaces/"+subNS)
+	if err != nil {
+		return err
+	}
+	time.Sleep(sleeping)
 	client.SetNamespace(os.Getenv("VAULT_NAMESPACE"))
 	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
 	if err != nil {
@@ -198,15 +301,9 @@ func checkTokenAuth(ctx context.Context, client *api.Client, path string) error
 		}
 	}
 
-	/*
-		err = sys.DisableAuthWithContext(ctx, path)
-		if err == nil {
-			return fmt.Errorf("should have failed")
-		} else if rErr, ok := err.(*api.ResponseError); !ok || rErr.StatusCode != 400 || (rErr.Errors)[0] != "token credential backend cannot be disabled" {
-			return fmt.Errorf("%#v", rErr.Errors)
-		}
-	*/
-	return nil
+	// the error text varies between servers, so it is declared in the server profiles
+	err = sys.DisableAuthWithContext(ctx, path)
+	return checkExpectedError(ctx, client, errDisableTokenAuth, err)
 }
 
 // getTokenAuthSecret creates a new token from client, which is associated with a namespace, with the given policies and returns the token auth and secret.
@@ -246,24 +343,95 @@ func getTokenAuthSecret(ctx context.Context, client *api.Client, rootToken strin
 	return tokenAuth, secret, nil
 }
 
-func revokeTokenByRootToken(ctx context.Context, client *api.Client, tokenAuth *api.TokenAuth, path, rootToken, token string) (*api.Secret, error) {
+// revokeTokenByRootToken revokes token with rootToken from the namespace of client,
+// and checks that the token is no longer valid in home, the namespace it was created in.
+func revokeTokenByRootToken(ctx context.Context, client, home *api.Client, path, rootToken, token string) error {
 	client.SetToken(rootToken)
 
 	secret, err := client.Logical().WriteWithContext(ctx, "auth/"+path+"/revoke", map[string]any{
 		"token": token,
 	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if secret != nil {
-		return nil, fmt.Errorf("secret found after revoke api: %+v", secret)
+		return fmt.Errorf("secret found after revoke api: %+v", secret)
+	}
+
+	tokenClient, err := newTokenClient(home, token)
+	if err != nil {
+		return err
+	}
+	ok, err := isTokenValid(ctx, tokenClient)
+	if err != nil {
+		return err
 	}
+	if ok {
+		return fmt.Errorf("token still valid in namespace %q after revocation from %q", home.Namespace(), client.Namespace())
+	}
+	return nil
+}
+
+// createChildToken creates a child token of parentToken in the namespace of client,
+// and returns a new client holding the child token in the same namespace.
+func createChildToken(ctx context.Context, client *api.Client, parentToken string, policy ...string) (*api.Client, error) {
+	client.SetToken(parentToken)
 
-	s, err := tokenAuth.LookupSelfWithContext(ctx)
+	secret, err := client.Auth().Token().CreateWithContext(ctx, &api.TokenCreateRequest{
+		Policies: policy,
+	})
 	if err != nil {
-		if rErr, ok := err.(*api.ResponseError); !ok || rErr.StatusCode != 403 || (rErr.Errors)[0] != "permission denied" {
-			return nil, fmt.Errorf("error: %#v", rErr.Errors)
+		return nil, err
+	}
+	if secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("Auth data: %+v", secret.Auth)
+	}
+
+	return newTokenClient(client, secret.Auth.ClientToken)
+}
+
+// newTokenClient returns a new client holding token in the namespace of client.
+func newTokenClient(client *api.Client, token string) (*api.Client, error) {
+	clone, err := client.Clone()
+	if err != nil {
+		return nil, err
+	}
+	clone.SetNamespace(client.Namespace())
+	clone.SetToken(token)
+	return clone, nil
+}
+
+// isTokenValid looks up the token of client in its own namespace.
+func isTokenValid(ctx context.Context, client *api.Client) (bool, error) {
+	_, err := client.Auth().Token().LookupSelfWithContext(ctx)
+	if err == nil {
+		return true, nil
+	}
+	if rErr, ok := err.(*api.ResponseError); !ok || rErr.StatusCode != 403 {
+		return false, err
+	}
+	return false, nil
+}
+
+// checkValidTokens checks that exactly the tokens named in valid are still valid.
+func checkValidTokens(ctx context.Context, tokens map[string]*api.Client, valid ...string) error {
+	for name, tokenClient := range tokens {
+		ok, err := isTokenValid(ctx, tokenClient)
+		if err != nil {
+			return err
 		}
+		if ok != slices.Contains(valid, name) {
+			return fmt.Errorf("token %s valid: %t, expected valid tokens: %v", name, ok, valid)
+		}
+	}
+	return nil
+}
+
+// getTokenCreateRule returns the ACL policy for creating child tokens in the sub namespace.
+func getTokenCreateRule(subNS string) string {
+	return `
+	path "` + subNS + `/auth/token/create" {
+		capabilities = ["create", "update"]
 	}
-	return s, nil
+	`
 }
@@ -42,3 +42,16 @@ func TestTokenMix(t *testing.T) {
 		t.Fatalf("TokenMix failed: %v", err)
 	}
 }
+
+// TestTokenHierarchy tests the revocation of a token hierarchy across the root namespace and two levels of namespaces.
+func TestTokenHierarchy(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckTokenHierarchy(client)
+	if err != nil {
+		t.Fatalf("TokenHierarchy failed: %v", err)
+	}
+}
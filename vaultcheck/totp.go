@@ -0,0 +1,236 @@
+package vaultcheck
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// CheckTOTPRoot checks the keys and codes of the TOTP secrets engine in the root namespace.
+func CheckTOTPRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	path := "totp"
+	_, err := checkTOTP(ctx, client, path)
+	if err != nil {
+		return err
+	}
+	return client.Sys().UnmountWithContext(ctx, path)
+}
+
+// CheckTOTPNamespace checks the keys and codes of the TOTP secrets engine in the namespace.
+func CheckTOTPNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	path := "totp"
+	_, err = checkTOTP(ctx, clone, path)
+	if err != nil {
+		return err
+	}
+	err = clone.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckTOTPMix checks that the TOTP keys of the root namespace and of the namespace are invisible to each other,
+// and that a code of the key mykey in one namespace is rejected by the key mykey in the other.
+func CheckTOTPMix(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	path := "totp"
+	rootKey, err := checkTOTP(ctx, client, path)
+	if err != nil {
+		return err
+	}
+	nsKey, err := checkTOTP(ctx, clone, path)
+	if err != nil {
+		return err
+	}
+	if rootKey == nsKey {
+		return fmt.Errorf("same TOTP secret generated in the root namespace and in the namespace")
+	}
+
+	for _, c := range []struct {
+		client *api.Client
+		key    string
+		other  *api.Client
+	}{
+		{client, rootKey, clone},
+		{clone, nsKey, client},
+	} {
+		// a key created in one namespace is invisible in the other
+		_, err = createTOTPKey(ctx, c.client, path, "private")
+		if err != nil {
+			return err
+		}
+		secret, err := c.other.Logical().ReadWithContext(ctx, path+"/keys/private")
+		if err == nil && secret != nil {
+			return fmt.Errorf("TOTP key of %q read in %q: %+v", c.client.Namespace(), c.other.Namespace(), secret.Data)
+		}
+		_, err = c.client.Logical().DeleteWithContext(ctx, path+"/keys/private")
+		if err != nil {
+			return err
+		}
+
+		valid, err := validateTOTPCode(ctx, c.other, path, "mykey", getTOTPCode(c.key, time.Now()))
+		if err != nil {
+			return err
+		}
+		if valid {
+			return fmt.Errorf("code of mykey in %q valid in %q", c.client.Namespace(), c.other.Namespace())
+		}
+	}
+
+	// clean up
+	err = clone.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	err = client.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkTOTP mounts the TOTP secrets engine at path in the namespace of client, generates the key mykey,
+// and checks its codes against the codes computed locally. It returns the base32 secret of the key.
+func checkTOTP(ctx context.Context, client *api.Client, path string) (string, error) {
+	err := client.Sys().MountWithContext(ctx, path, &api.MountInput{
+		Type: "totp",
+	})
+	if err != nil {
+		return "", err
+	}
+	time.Sleep(sleeping)
+
+	key, err := createTOTPKey(ctx, client, path, "mykey")
+	if err != nil {
+		return "", err
+	}
+
+	// the server code is the local code of the current or, at a step boundary, of the next period
+	now := time.Now()
+	secret, err := client.Logical().ReadWithContext(ctx, path+"/code/mykey")
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["code"] == nil {
+		return "", fmt.Errorf("code of mykey: %+v", secret)
+	}
+	code := secret.Data["code"].(string)
+	if code != getTOTPCode(key, now) && code != getTOTPCode(key, now.Add(30*time.Second)) {
+		return "", fmt.Errorf("code of mykey %s, locally %s", code, getTOTPCode(key, now))
+	}
+
+	valid, err := validateTOTPCode(ctx, client, path, "mykey", getTOTPCode(key, time.Now()))
+	if err != nil {
+		return "", err
+	}
+	if !valid {
+		return "", fmt.Errorf("local code of mykey rejected")
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil {
+		return "", err
+	}
+	wrong := fmt.Sprintf("%06d", (n+500000)%1000000)
+	valid, err = validateTOTPCode(ctx, client, path, "mykey", wrong)
+	if err != nil {
+		return "", err
+	}
+	if valid {
+		return "", fmt.Errorf("wrong code %s of mykey accepted", wrong)
+	}
+	return key, nil
+}
+
+// createTOTPKey generates the named TOTP key, and returns its base32 secret read from the key URL.
+func createTOTPKey(ctx context.Context, client *api.Client, path, name string) (string, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, path+"/keys/"+name, map[string]any{
+		"generate":     true,
+		"issuer":       "nscheck",
+		"account_name": "alice@example.com",
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["url"] == nil {
+		return "", fmt.Errorf("TOTP key %s: %+v", name, secret)
+	}
+	u, err := url.Parse(secret.Data["url"].(string))
+	if err != nil {
+		return "", err
+	}
+	key := u.Query().Get("secret")
+	if key == "" {
+		return "", fmt.Errorf("no secret in the URL of TOTP key %s", name)
+	}
+	return key, nil
+}
+
+// validateTOTPCode asks the server whether the code is valid for the named key.
+func validateTOTPCode(ctx context.Context, client *api.Client, path, name, code string) (bool, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, path+"/code/"+name, map[string]any{
+		"code": code,
+	})
+	if err != nil {
+		return false, err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["valid"] == nil {
+		return false, fmt.Errorf("validation of %s: %+v", name, secret)
+	}
+	return secret.Data["valid"].(bool), nil
+}
+
+// getTOTPCode computes the RFC 6238 code of the base32 key at t, with the defaults of the engine:
+// HMAC-SHA1, a period of 30 seconds and 6 digits.
+func getTOTPCode(key string, t time.Time) string {
+	key = strings.ToUpper(strings.TrimRight(key, "="))
+	bs, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(key)
+	if err != nil {
+		return ""
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/30))
+	mac := hmac.New(sha1.New, bs)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
@@ -0,0 +1,44 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestTOTPRoot tests the TOTP secrets engine at the root namespace.
+func TestTOTPRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckTOTPRoot(client)
+	if err != nil {
+		t.Fatalf("TOTPRoot failed: %v", err)
+	}
+}
+
+// TestTOTPNamespace tests the TOTP secrets engine in a specific namespace.
+func TestTOTPNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckTOTPNamespace(client)
+	if err != nil {
+		t.Fatalf("TOTPNamespace failed: %v", err)
+	}
+}
+
+// TestTOTPMix tests that TOTP keys in different namespaces are isolated.
+func TestTOTPMix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckTOTPMix(client)
+	if err != nil {
+		t.Fatalf("TOTPMix failed: %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package vaultcheck
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// CheckTransitRoot checks the transit keys, their rotation, minimum decryption version and export in the root namespace.
+func CheckTransitRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	path := "transit"
+	err := checkTransit(ctx, client, path)
+	if err != nil {
+		return err
+	}
+	return client.Sys().UnmountWithContext(ctx, path)
+}
+
+// CheckTransitNamespace checks the transit keys, their rotation, minimum decryption version and export in the namespace.
+func CheckTransitNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	path := "transit"
+	err = checkTransit(ctx, clone, path)
+	if err != nil {
+		return err
+	}
+	err = clone.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckTransitMix checks that identically named transit keys in the root namespace and in the namespace
+// cannot decrypt each other's ciphertexts, and keep their own settings.
+func CheckTransitMix(client *api.Client) error {
+	ctx := context.Background()
+
+	path := "transit"
+	err := checkTransit(ctx, client, path)
+	if err != nil {
+		return err
+	}
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+	err = mountTransit(ctx, clone, path)
+	if err != nil {
+		return err
+	}
+	err = createTransitKey(ctx, clone, path, "mykey", nil)
+	if err != nil {
+		return err
+	}
+	// rotate once, so that both ciphertexts are of version 2
+	_, err = clone.Logical().WriteWithContext(ctx, path+"/keys/mykey/rotate", nil)
+	if err != nil {
+		return err
+	}
+
+	plaintext := "my secret data"
+	ciphertext, err := transitEncrypt(ctx, client, path, "mykey", plaintext)
+	if err != nil {
+		return err
+	}
+	ciphertextNS, err := transitEncrypt(ctx, clone, path, "mykey", plaintext)
+	if err != nil {
+		return err
+	}
+	decrypted, err := transitDecrypt(ctx, clone, path, "mykey", ciphertext)
+	if err == nil {
+		return fmt.Errorf("ciphertext of the root namespace decrypted in the namespace: %q", decrypted)
+	}
+	decrypted, err = transitDecrypt(ctx, client, path, "mykey", ciphertextNS)
+	if err == nil {
+		return fmt.Errorf("ciphertext of the namespace decrypted in the root namespace: %q", decrypted)
+	}
+
+	// the key of the root namespace was restricted and made exportable, not the key of the namespace
+	secret, err := clone.Logical().ReadWithContext(ctx, path+"/keys/mykey")
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Data == nil ||
+		fmt.Sprint(secret.Data["latest_version"]) != "2" ||
+		fmt.Sprint(secret.Data["min_decryption_version"]) != "1" ||
+		secret.Data["exportable"] != false {
+		return fmt.Errorf("transit key in the namespace: %+v", secret)
+	}
+
+	// clean up
+	err = clone.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	err = client.Sys().UnmountWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkTransit mounts transit at path in the namespace of client, creates an exportable key mykey,
+// rotates it, raises its minimum decryption version, and exports it.
+func checkTransit(ctx context.Context, client *api.Client, path string) error {
+	logical := client.Logical()
+
+	err := mountTransit(ctx, client, path)
+	if err != nil {
+		return err
+	}
+	err = createTransitKey(ctx, client, path, "mykey", map[string]any{
+		"exportable": true,
+	})
+	if err != nil {
+		return err
+	}
+	err = createTransitKey(ctx, client, path, "private", nil)
+	if err != nil {
+		return err
+	}
+
+	plaintext := "my secret data"
+	ciphertext1, err := transitEncrypt(ctx, client, path, "mykey", plaintext)
+	if err != nil {
+		return err
+	}
+
+	// rotate
+	_, err = logical.WriteWithContext(ctx, path+"/keys/mykey/rotate", nil)
+	if err != nil {
+		return err
+	}
+	ciphertext2, err := transitEncrypt(ctx, client, path, "mykey", plaintext)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(ciphertext2, ":v2:") {
+		return fmt.Errorf("ciphertext after rotation: %s", ciphertext2)
+	}
+	for _, ciphertext := range []string{ciphertext1, ciphertext2} {
+		decrypted, err := transitDecrypt(ctx, client, path, "mykey", ciphertext)
+		if err != nil {
+			return err
+		}
+		if decrypted != plaintext {
+			return fmt.Errorf("decrypted %q, not %q", decrypted, plaintext)
+		}
+	}
+
+	// version 1 can no longer be decrypted
+	_, err = logical.WriteWithContext(ctx, path+"/keys/mykey/config", map[string]any{
+		"min_decryption_version": 2,
+	})
+	if err != nil {
+		return err
+	}
+	decrypted, err := transitDecrypt(ctx, client, path, "mykey", ciphertext1)
+	if err == nil {
+		return fmt.Errorf("ciphertext of version 1 decrypted after min_decryption_version 2: %q", decrypted)
+	}
+	_, err = transitDecrypt(ctx, client, path, "mykey", ciphertext2)
+	if err != nil {
+		return err
+	}
+
+	// only the exportable key is exported
+	secret, err := logical.ReadWithContext(ctx, path+"/export/encryption-key/mykey")
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["keys"] == nil {
+		return fmt.Errorf("export of mykey: %+v", secret)
+	}
+	if keys := secret.Data["keys"].(map[string]any); len(keys) != 1 || keys["2"] == nil {
+		return fmt.Errorf("exported versions of mykey: %v", keys)
+	}
+	secret, err = logical.ReadWithContext(ctx, path+"/export/encryption-key/private")
+	if err == nil {
+		return fmt.Errorf("export of a non-exportable key: %+v", secret)
+	}
+	return nil
+}
+
+// mountTransit mounts the transit secrets engine at path in the namespace of client.
+func mountTransit(ctx context.Context, client *api.Client, path string) error {
+	err := client.Sys().MountWithContext(ctx, path, &api.MountInput{
+		Type: "transit",
+	})
+	if err != nil {
+		return err
+	}
+	time.Sleep(sleeping)
+	return nil
+}
+
+// createTransitKey creates the named transit key with the given options.
+func createTransitKey(ctx context.Context, client *api.Client, path, name string, options map[string]any) error {
+	_, err := client.Logical().WriteWithContext(ctx, path+"/keys/"+name, options)
+	return err
+}
+
+// transitEncrypt encrypts the plaintext with the named key and returns the ciphertext.
+func transitEncrypt(ctx context.Context, client *api.Client, path, name, plaintext string) (string, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, path+"/encrypt/"+name, map[string]any{
+		"plaintext": base64.StdEncoding.EncodeToString([]byte(plaintext)),
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["ciphertext"] == nil {
+		return "", fmt.Errorf("encrypt with %s: %+v", name, secret)
+	}
+	return secret.Data["ciphertext"].(string), nil
+}
+
+// transitDecrypt decrypts the ciphertext with the named key and returns the plaintext.
+func transitDecrypt(ctx context.Context, client *api.Client, path, name, ciphertext string) (string, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, path+"/decrypt/"+name, map[string]any{
+		"ciphertext": ciphertext,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil || secret.Data["plaintext"] == nil {
+		return "", fmt.Errorf("decrypt with %s: %+v", name, secret)
+	}
+	bs, err := base64.StdEncoding.DecodeString(secret.Data["plaintext"].(string))
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
@@ -0,0 +1,44 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestTransitRoot tests the transit secrets engine at the root namespace.
+func TestTransitRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckTransitRoot(client)
+	if err != nil {
+		t.Fatalf("TransitRoot failed: %v", err)
+	}
+}
+
+// TestTransitNamespace tests the transit secrets engine in a specific namespace.
+func TestTransitNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckTransitNamespace(client)
+	if err != nil {
+		t.Fatalf("TransitNamespace failed: %v", err)
+	}
+}
+
+// TestTransitMix tests that identically named transit keys in different namespaces are isolated.
+func TestTransitMix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckTransitMix(client)
+	if err != nil {
+		t.Fatalf("TransitMix failed: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package vaultcheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// CheckTuneRoot checks the tuning of a secrets engine and an auth method in the root namespace.
+func CheckTuneRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	err := checkTune(ctx, client, getTuneConfig("root", "1h", "2h", "unauth"))
+	if err != nil {
+		return err
+	}
+	return dropTune(ctx, client)
+}
+
+// CheckTuneNamespace checks the tuning of a secrets engine and an auth method in the namespace.
+func CheckTuneNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	err = checkTune(ctx, clone, getTuneConfig(rootNS, "30m", "90m", "unauth"))
+	if err != nil {
+		return err
+	}
+	err = dropTune(ctx, clone)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckTuneMix checks that the identically named mounts of the root namespace, the namespace pname
+// and the namespace qname keep their own tuning: pname is tuned after the root namespace, and qname is not tuned.
+func CheckTuneMix(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+	siblingNS := "qname"
+	sibling, err := cloneClient(ctx, client, siblingNS)
+	if err != nil {
+		return err
+	}
+
+	rootConfig := getTuneConfig("root", "1h", "2h", "unauth")
+	err = checkTune(ctx, client, rootConfig)
+	if err != nil {
+		return err
+	}
+	err = checkTune(ctx, clone, getTuneConfig(rootNS, "30m", "90m", "hidden"))
+	if err != nil {
+		return err
+	}
+	// the tuning of pname did not reach the root namespace
+	for _, path := range []string{"tunekv", "auth/tuneup"} {
+		err = checkTuneConfig(ctx, client, path, rootConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	// qname keeps the defaults, with the lease TTLs of the system mount, which is never tuned
+	err = mountTune(ctx, sibling)
+	if err != nil {
+		return err
+	}
+	defaults, err := sibling.Sys().MountConfigWithContext(ctx, "sys")
+	if err != nil {
+		return err
+	}
+	for _, path := range []string{"tunekv", "auth/tuneup"} {
+		config, err := sibling.Sys().MountConfigWithContext(ctx, path)
+		if err != nil {
+			return err
+		}
+		if config.DefaultLeaseTTL != defaults.DefaultLeaseTTL || config.MaxLeaseTTL != defaults.MaxLeaseTTL ||
+			config.ListingVisibility != "" || len(config.AuditNonHMACRequestKeys) > 0 || len(config.PassthroughRequestHeaders) > 0 {
+			return fmt.Errorf("tuning of %s in %q: %+v", path, sibling.Namespace(), config)
+		}
+		description, err := readMountDescription(ctx, sibling, path)
+		if err != nil {
+			return err
+		}
+		if description != "" {
+			return fmt.Errorf("description of %s in %q: %s", path, sibling.Namespace(), description)
+		}
+	}
+
+	// clean up
+	err = dropTune(ctx, client)
+	if err != nil {
+		return err
+	}
+	for _, ns := range []string{rootNS, siblingNS} {
+		_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+ns)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTune mounts KV1 at tunekv and enables userpass at tuneup in the namespace of client,
+// tunes both with config, and reads the tuning back.
+func checkTune(ctx context.Context, client *api.Client, config api.MountConfigInput) error {
+	err := mountTune(ctx, client)
+	if err != nil {
+		return err
+	}
+	for _, path := range []string{"tunekv", "auth/tuneup"} {
+		err = client.Sys().TuneMountWithContext(ctx, path, config)
+		if err != nil {
+			return err
+		}
+		err = checkTuneConfig(ctx, client, path, config)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mountTune mounts KV1 at tunekv and enables userpass at tuneup in the namespace of client.
+func mountTune(ctx context.Context, client *api.Client) error {
+	sys := client.Sys()
+
+	err := sys.MountWithContext(ctx, "tunekv", &api.MountInput{
+		Type: "kv",
+	})
+	if err != nil {
+		return err
+	}
+	err = sys.EnableAuthWithOptionsWithContext(ctx, "tuneup", &api.EnableAuthOptions{
+		Type: "userpass",
+	})
+	if err != nil {
+		return err
+	}
+	time.Sleep(sleeping)
+	return nil
+}
+
+// dropTune unmounts tunekv and disables tuneup in the namespace of client.
+func dropTune(ctx context.Context, client *api.Client) error {
+	sys := client.Sys()
+
+	err := sys.UnmountWithContext(ctx, "tunekv")
+	if err != nil {
+		return err
+	}
+	return sys.DisableAuthWithContext(ctx, "tuneup")
+}
+
+// checkTuneConfig reads the tuning of the mount at path, and compares it to config.
+func checkTuneConfig(ctx context.Context, client *api.Client, path string, config api.MountConfigInput) error {
+	output, err := client.Sys().MountConfigWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	for _, ttl := range []struct {
+		name   string
+		input  string
+		output int
+	}{
+		{"default_lease_ttl", config.DefaultLeaseTTL, output.DefaultLeaseTTL},
+		{"max_lease_ttl", config.MaxLeaseTTL, output.MaxLeaseTTL},
+	} {
+		d, err := time.ParseDuration(ttl.input)
+		if err != nil {
+			return err
+		}
+		if int(d.Seconds()) != ttl.output {
+			return fmt.Errorf("%s of %s in %q: %d, expected %s", ttl.name, path, client.Namespace(), ttl.output, ttl.input)
+		}
+	}
+	if output.ListingVisibility != config.ListingVisibility ||
+		!slices.Equal(output.AuditNonHMACRequestKeys, config.AuditNonHMACRequestKeys) ||
+		!slices.Equal(output.PassthroughRequestHeaders, config.PassthroughRequestHeaders) {
+		return fmt.Errorf("tuning of %s in %q: %+v", path, client.Namespace(), output)
+	}
+
+	description, err := readMountDescription(ctx, client, path)
+	if err != nil {
+		return err
+	}
+	if description != *config.Description {
+		return fmt.Errorf("description of %s in %q: %s, expected %s", path, client.Namespace(), description, *config.Description)
+	}
+	return nil
+}
+
+// readMountDescription reads the description of the secrets engine or, with the auth/ prefix, the auth method at path.
+func readMountDescription(ctx context.Context, client *api.Client, path string) (string, error) {
+	mountPath := "sys/mounts/" + path
+	if auth, ok := strings.CutPrefix(path, "auth/"); ok {
+		mountPath = "sys/auth/" + auth
+	}
+	secret, err := client.Logical().ReadWithContext(ctx, mountPath)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return "", fmt.Errorf("mount %s: %+v", path, secret)
+	}
+	description, _ := secret.Data["description"].(string)
+	return description, nil
+}
+
+// getTuneConfig returns a tuning labelled with the name, with the lease TTLs and the listing visibility.
+func getTuneConfig(name, defaultTTL, maxTTL, visibility string) api.MountConfigInput {
+	description := "tuned in " + name
+	return api.MountConfigInput{
+		DefaultLeaseTTL:           defaultTTL,
+		MaxLeaseTTL:               maxTTL,
+		ListingVisibility:         visibility,
+		AuditNonHMACRequestKeys:   []string{"username-" + name},
+		PassthroughRequestHeaders: []string{http.CanonicalHeaderKey("X-Nscheck-" + name)},
+		Description:               &description,
+	}
+}
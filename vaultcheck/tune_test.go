@@ -0,0 +1,44 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestTuneRoot tests the tuning of mounts and auth methods at the root namespace.
+func TestTuneRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckTuneRoot(client)
+	if err != nil {
+		t.Fatalf("TuneRoot failed: %v", err)
+	}
+}
+
+// TestTuneNamespace tests the tuning of mounts and auth methods in a specific namespace.
+func TestTuneNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckTuneNamespace(client)
+	if err != nil {
+		t.Fatalf("TuneNamespace failed: %v", err)
+	}
+}
+
+// TestTuneMix tests that the tuning of identically named mounts is isolated per namespace.
+func TestTuneMix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckTuneMix(client)
+	if err != nil {
+		t.Fatalf("TuneMix failed: %v", err)
+	}
+}
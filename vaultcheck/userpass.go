@@ -0,0 +1,315 @@
+package vaultcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// CheckUserpassRoot checks the management of userpass users in the root namespace.
+func CheckUserpassRoot(client *api.Client) error {
+	ctx := context.Background()
+
+	return checkUserpass(ctx, client, "userpass")
+}
+
+// CheckUserpassNamespace checks the management of userpass users in the namespace.
+func CheckUserpassNamespace(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	err = checkUserpass(ctx, clone, "userpass")
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckUserpassMix checks that the user alice of the userpass auth at userpass and userpass2 in the root namespace,
+// and at userpass in the namespace, are fully independent.
+func CheckUserpassMix(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+
+	type userpassMount struct {
+		client   *api.Client
+		path     string
+		password string
+		policy   string
+	}
+	mounts := []userpassMount{
+		{client, "userpass", "pass1", "policy1"},
+		{client, "userpass2", "pass2", "policy2"},
+		{clone, "userpass", "pass3", "policy3"},
+	}
+	for _, m := range mounts {
+		err = m.client.Sys().EnableAuthWithOptionsWithContext(ctx, m.path, &api.EnableAuthOptions{
+			Type: "userpass",
+		})
+		if err != nil {
+			return err
+		}
+		time.Sleep(sleeping)
+		err = putUserpassUser(ctx, m.client, m.path, "alice", m.password, m.policy)
+		if err != nil {
+			return err
+		}
+	}
+
+	// alice logs in with her own password and gets her own policy only
+	for _, m := range mounts {
+		for _, other := range mounts {
+			secret, err := m.client.Logical().WriteWithContext(ctx, "auth/"+m.path+"/login/alice", map[string]any{
+				"password": other.password,
+			})
+			if other.password != m.password {
+				if err == nil {
+					return fmt.Errorf("alice at %s in %q logged in with the password of %s", m.path, m.client.Namespace(), other.path)
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if secret == nil || secret.Auth == nil || !slices.Equal(secret.Auth.TokenPolicies, []string{"default", m.policy}) {
+				return fmt.Errorf("alice at %s in %q: %+v", m.path, m.client.Namespace(), secret)
+			}
+		}
+	}
+
+	// deleting alice in the namespace leaves the others
+	_, err = clone.Logical().DeleteWithContext(ctx, "auth/userpass/users/alice")
+	if err != nil {
+		return err
+	}
+	for i, m := range mounts {
+		_, err = loginUserpass(ctx, m.client, m.path, "alice", m.password)
+		if i < 2 && err != nil {
+			return err
+		}
+		if i == 2 && err == nil {
+			return fmt.Errorf("deleted alice logged in")
+		}
+	}
+
+	// clean up
+	for _, m := range mounts {
+		err = m.client.Sys().DisableAuthWithContext(ctx, m.path)
+		if err != nil {
+			return err
+		}
+	}
+	client.SetNamespace(os.Getenv("VAULT_NAMESPACE"))
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkUserpass enables userpass at path in the namespace of client, creates several users, updates
+// their password, policies, TTL and bound CIDRs, and deletes them.
+func checkUserpass(ctx context.Context, client *api.Client, path string) error {
+	logical := client.Logical()
+
+	err := client.Sys().EnableAuthWithOptionsWithContext(ctx, path, &api.EnableAuthOptions{
+		Type: "userpass",
+	})
+	if err != nil {
+		return err
+	}
+	time.Sleep(sleeping)
+
+	users := []string{"alice", "bob", "carol"}
+	for _, user := range users {
+		err = putUserpassUser(ctx, client, path, user, user+"-pass", "default")
+		if err != nil {
+			return err
+		}
+		_, err = loginUserpass(ctx, client, path, user, user+"-pass")
+		if err != nil {
+			return err
+		}
+	}
+	err = checkUserpassUsers(ctx, client, path, users...)
+	if err != nil {
+		return err
+	}
+
+	// update the password of alice
+	_, err = logical.WriteWithContext(ctx, "auth/"+path+"/users/alice/password", map[string]any{
+		"password": "alice-new",
+	})
+	if err != nil {
+		return err
+	}
+	_, err = loginUserpass(ctx, client, path, "alice", "alice-pass")
+	if err == nil {
+		return fmt.Errorf("alice logged in with her old password")
+	}
+	_, err = loginUserpass(ctx, client, path, "alice", "alice-new")
+	if err != nil {
+		return err
+	}
+
+	// change the policies of bob
+	_, err = logical.WriteWithContext(ctx, "auth/"+path+"/users/bob/policies", map[string]any{
+		"token_policies": []string{"mypolicy"},
+	})
+	if err != nil {
+		return err
+	}
+	secret, err := logical.WriteWithContext(ctx, "auth/"+path+"/login/bob", map[string]any{
+		"password": "bob-pass",
+	})
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Auth == nil || !slices.Contains(secret.Auth.TokenPolicies, "mypolicy") {
+		return fmt.Errorf("bob policies: %+v", secret)
+	}
+
+	// change the token TTL of carol
+	_, err = logical.WriteWithContext(ctx, "auth/"+path+"/users/carol", map[string]any{
+		"token_ttl": "1h",
+	})
+	if err != nil {
+		return err
+	}
+	secret, err = logical.WriteWithContext(ctx, "auth/"+path+"/login/carol", map[string]any{
+		"password": "carol-pass",
+	})
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.LeaseDuration != 3600 {
+		return fmt.Errorf("carol TTL: %+v", secret)
+	}
+
+	// bind carol to an address we are not calling from, either her login or her token is refused
+	_, err = logical.WriteWithContext(ctx, "auth/"+path+"/users/carol", map[string]any{
+		"token_bound_cidrs": []string{"192.0.2.0/24"},
+	})
+	if err != nil {
+		return err
+	}
+	token, err := loginUserpass(ctx, client, path, "carol", "carol-pass")
+	if err == nil {
+		err = checkTokenUses(ctx, client, token, 0)
+		if err != nil {
+			return err
+		}
+	} else if !isCIDRRejection(err) {
+		return fmt.Errorf("carol bound to 192.0.2.0/24: %w", err)
+	}
+
+	// delete alice
+	_, err = logical.DeleteWithContext(ctx, "auth/"+path+"/users/alice")
+	if err != nil {
+		return err
+	}
+	_, err = loginUserpass(ctx, client, path, "alice", "alice-new")
+	if err == nil {
+		return fmt.Errorf("deleted alice logged in")
+	}
+	err = checkUserpassUsers(ctx, client, path, "bob", "carol")
+	if err != nil {
+		return err
+	}
+
+	return client.Sys().DisableAuthWithContext(ctx, path)
+}
+
+// checkUserpassUsers checks that the users of the userpass auth at path are exactly the given ones.
+func checkUserpassUsers(ctx context.Context, client *api.Client, path string, users ...string) error {
+	rspn, err := client.Logical().ListWithContext(ctx, "auth/"+path+"/users")
+	if err != nil {
+		return err
+	}
+	if rspn == nil || rspn.Data == nil || rspn.Data["keys"] == nil {
+		return fmt.Errorf("list response data nil: %+v", rspn)
+	}
+	var keys []string
+	for _, k := range rspn.Data["keys"].([]any) {
+		keys = append(keys, k.(string))
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, users) {
+		return fmt.Errorf("users %v, expected %v", keys, users)
+	}
+	return nil
+}
+
+// putUserpassUser creates or updates the user of the userpass auth at path with the given policies.
+func putUserpassUser(ctx context.Context, client *api.Client, path, username, password string, policy ...string) error {
+	secret, err := client.Logical().WriteWithContext(ctx, "auth/"+path+"/users/"+username, map[string]any{
+		"password":       password,
+		"token_policies": policy,
+	})
+	if err != nil {
+		return err
+	}
+	if secret != nil {
+		return fmt.Errorf("secret found after create user api: %+v", secret)
+	}
+	return nil
+}
+
+// loginUserpass logs in as the user of the userpass auth at path and returns the client token.
+func loginUserpass(ctx context.Context, client *api.Client, path, username, password string) (string, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, "auth/"+path+"/login/"+username, map[string]any{
+		"password": password,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return "", fmt.Errorf("Auth data: %+v", secret)
+	}
+	return secret.Auth.ClientToken, nil
+}
+
+// cidrRejection matches the error of a login from outside the bound CIDRs, naming the CIDR or the address.
+var cidrRejection = regexp.MustCompile(`(?i)cidr|192\.0\.2\.0/24|remote address`)
+
+// isCIDRRejection tells whether err is the refusal of a login from outside the bound CIDRs, rather than
+// a wrong password, a wrong mount or a server fault: a 400 or 403 naming the CIDR, or the bare 403
+// permission denied which userpass answers without saying why.
+func isCIDRRejection(err error) bool {
+	var rErr *api.ResponseError
+	if !errors.As(err, &rErr) {
+		return false
+	}
+	switch rErr.StatusCode {
+	case http.StatusForbidden:
+		if slices.Equal(rErr.Errors, []string{"permission denied"}) {
+			return true
+		}
+		fallthrough
+	case http.StatusBadRequest:
+		return slices.ContainsFunc(rErr.Errors, cidrRejection.MatchString)
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestUserpassRoot tests the userpass authentication method at the root namespace.
+func TestUserpassRoot(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckUserpassRoot(client)
+	if err != nil {
+		t.Fatalf("UserpassRoot failed: %v", err)
+	}
+}
+
+// TestUserpassNamespace tests the userpass authentication method in a specific namespace.
+func TestUserpassNamespace(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckUserpassNamespace(client)
+	if err != nil {
+		t.Fatalf("UserpassNamespace failed: %v", err)
+	}
+}
+
+// TestUserpassMix tests that identical usernames in different namespaces and mount paths are independent.
+func TestUserpassMix(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckUserpassMix(client)
+	if err != nil {
+		t.Fatalf("UserpassMix failed: %v", err)
+	}
+}
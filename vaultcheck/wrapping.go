@@ -0,0 +1,199 @@
+package vaultcheck
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/openbao/openbao/api/v2"
+)
+
+// CheckWrapping checks that arbitrary data wrapped by a token of the namespace pname/cname,
+// through the paths granted by the default policy, can be looked up and unwrapped exactly once
+// and before its TTL, from the same and the parent namespace only, and that rewrapping
+// invalidates the former wrapping token.
+func CheckWrapping(client *api.Client) error {
+	ctx := context.Background()
+
+	rootNS := "pname"
+	clone, err := cloneClient(ctx, client, rootNS)
+	if err != nil {
+		return err
+	}
+	subNS := "cname"
+	clone2, err := cloneClient(ctx, clone, subNS)
+	if err != nil {
+		return err
+	}
+	siblingNS := "dname"
+	sibling, err := cloneClient(ctx, clone, siblingNS)
+	if err != nil {
+		return err
+	}
+
+	// a token with the default paths, and rewrap, in each namespace
+	rootToken := client.Token()
+	name := "wrapper"
+	tokens := make(map[string]*api.Client)
+	for rel, c := range map[string]*api.Client{"same": clone2, "parent": clone, "sibling": sibling} {
+		err = c.Sys().PutPolicyWithContext(ctx, name, getDefaultRule()+getRewrapRule())
+		if err != nil {
+			return err
+		}
+		tokens[rel], err = createChildToken(ctx, c, rootToken, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	data := map[string]any{
+		"username": "myadmin",
+		"password": "123456",
+	}
+
+	// look up and unwrap in the same namespace, and in the parent namespace
+	for _, rel := range []string{"same", "parent"} {
+		c := tokens[rel]
+		wrappingToken, err := wrapData(ctx, tokens["same"], data, "60s")
+		if err != nil {
+			return err
+		}
+		secret, err := c.Logical().WriteWithContext(ctx, "sys/wrapping/lookup", map[string]any{
+			"token": wrappingToken,
+		})
+		if err != nil {
+			return fmt.Errorf("lookup in %s: %w", c.Namespace(), err)
+		}
+		if secret == nil || secret.Data == nil || secret.Data["creation_path"] != "sys/wrapping/wrap" || fmt.Sprint(secret.Data["creation_ttl"]) != "60" {
+			return fmt.Errorf("lookup in %s: %+v", c.Namespace(), secret)
+		}
+		err = unwrapData(ctx, c, wrappingToken, data)
+		if err != nil {
+			return fmt.Errorf("unwrap in %s: %w", c.Namespace(), err)
+		}
+		// single use
+		_, err = c.Logical().UnwrapWithContext(ctx, wrappingToken)
+		if err == nil {
+			return fmt.Errorf("wrapping token unwrapped twice in %s", c.Namespace())
+		}
+	}
+
+	// the sibling namespace can neither look up, unwrap nor rewrap, and does not consume the wrapping token
+	wrappingToken, err := wrapData(ctx, tokens["same"], data, "60s")
+	if err != nil {
+		return err
+	}
+	secret, err := tokens["sibling"].Logical().WriteWithContext(ctx, "sys/wrapping/lookup", map[string]any{
+		"token": wrappingToken,
+	})
+	if err == nil {
+		return fmt.Errorf("wrapping token looked up in sibling %s: %+v", sibling.Namespace(), secret)
+	}
+	secret, err = tokens["sibling"].Logical().UnwrapWithContext(ctx, wrappingToken)
+	if err == nil {
+		return fmt.Errorf("wrapping token unwrapped in sibling %s: %+v", sibling.Namespace(), secret)
+	}
+	_, err = rewrapData(ctx, tokens["sibling"], wrappingToken)
+	if err == nil {
+		return fmt.Errorf("wrapping token rewrapped in sibling %s", sibling.Namespace())
+	}
+
+	// rewrap invalidates the former wrapping token
+	rewrappedToken, err := rewrapData(ctx, tokens["same"], wrappingToken)
+	if err != nil {
+		return err
+	}
+	if rewrappedToken == wrappingToken {
+		return fmt.Errorf("rewrap returned the same wrapping token")
+	}
+	_, err = tokens["same"].Logical().UnwrapWithContext(ctx, wrappingToken)
+	if err == nil {
+		return fmt.Errorf("former wrapping token unwrapped after rewrap")
+	}
+	err = unwrapData(ctx, tokens["same"], rewrappedToken, data)
+	if err != nil {
+		return err
+	}
+
+	// the wrapping token expires
+	wrappingToken, err = wrapData(ctx, tokens["same"], data, "5s")
+	if err != nil {
+		return err
+	}
+	time.Sleep(2 * sleeping)
+	secret, err = tokens["same"].Logical().WriteWithContext(ctx, "sys/wrapping/lookup", map[string]any{
+		"token": wrappingToken,
+	})
+	if err == nil {
+		return fmt.Errorf("wrapping token looked up after its TTL: %+v", secret)
+	}
+	secret, err = tokens["same"].Logical().UnwrapWithContext(ctx, wrappingToken)
+	if err == nil {
+		return fmt.Errorf("wrapping token unwrapped after its TTL: %+v", secret)
+	}
+
+	// clean up
+	for _, ns := range []string{subNS, siblingNS} {
+		_, err = clone.Logical().DeleteWithContext(ctx, "sys/namespaces/"+ns)
+		if err != nil {
+			return err
+		}
+	}
+	time.Sleep(sleeping)
+	_, err = client.Logical().DeleteWithContext(ctx, "sys/namespaces/"+rootNS)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// wrapData wraps the data with the TTL through sys/wrapping/wrap, and returns the wrapping token.
+func wrapData(ctx context.Context, client *api.Client, data map[string]any, ttl string) (string, error) {
+	clone, err := newTokenClient(client, client.Token())
+	if err != nil {
+		return "", err
+	}
+	clone.SetWrappingLookupFunc(func(string, string) string {
+		return ttl
+	})
+
+	secret, err := clone.Logical().WriteWithContext(ctx, "sys/wrapping/wrap", data)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" {
+		return "", fmt.Errorf("no wrap info: %+v", secret)
+	}
+	return secret.WrapInfo.Token, nil
+}
+
+// unwrapData unwraps the wrapping token and checks that it holds the data.
+func unwrapData(ctx context.Context, client *api.Client, wrappingToken string, data map[string]any) error {
+	secret, err := client.Logical().UnwrapWithContext(ctx, wrappingToken)
+	if err != nil {
+		return err
+	}
+	if secret == nil || secret.Data == nil {
+		return fmt.Errorf("unwrapped: %+v", secret)
+	}
+	for k, v := range data {
+		if secret.Data[k] != v {
+			return fmt.Errorf("unwrapped %s: %v, expected %v", k, secret.Data[k], v)
+		}
+	}
+	return nil
+}
+
+// rewrapData rewraps the wrapping token through sys/wrapping/rewrap, and returns the new wrapping token.
+func rewrapData(ctx context.Context, client *api.Client, wrappingToken string) (string, error) {
+	secret, err := client.Logical().WriteWithContext(ctx, "sys/wrapping/rewrap", map[string]any{
+		"token": wrappingToken,
+	})
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.WrapInfo == nil || secret.WrapInfo.Token == "" {
+		return "", fmt.Errorf("no wrap info after rewrap: %+v", secret)
+	}
+	return secret.WrapInfo.Token, nil
+}
@@ -0,0 +1,18 @@
+package vaultcheck
+
+import (
+	"testing"
+)
+
+// TestWrapping tests response wrapping of arbitrary data across the same, parent and sibling namespaces.
+func TestWrapping(t *testing.T) {
+	client, err := getClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	err = CheckWrapping(client)
+	if err != nil {
+		t.Fatalf("Wrapping failed: %v", err)
+	}
+}